@@ -0,0 +1,505 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/amb1s1/go-eve/eveapi"
+	"github.com/amb1s1/go-eve/goeve"
+)
+
+// command runs a goeve subcommand with the arguments following its name.
+type command func(args []string) error
+
+var commands = map[string]command{
+	"ssh":         sshCommand,
+	"tunnel":      tunnelCommand,
+	"sync":        syncCommand,
+	"credentials": credentialsCommand,
+	"verify":      verifyCommand,
+	"version":     versionCommand,
+	"lab":         labCommand,
+	"node":        nodeCommand,
+	"backup":      backupCommand,
+	"restore":     restoreCommand,
+	"image":       imageCommand,
+}
+
+func runCommand(name string, args []string) error {
+	cmd, ok := commands[name]
+	if !ok {
+		return fmt.Errorf("unknown command %q", name)
+	}
+
+	return cmd(args)
+}
+
+// labArg returns the lab named by the i-th argument of fs, falling back to
+// the instance_name flag.
+func labArg(fs *flag.FlagSet, i int) string {
+	if fs.NArg() > i {
+		return fs.Arg(i)
+	}
+
+	return *instanceName
+}
+
+// sshCommand handles: ssh [lab]
+func sshCommand(args []string) error {
+	fs := flag.NewFlagSet("ssh", flag.ExitOnError)
+	fs.Parse(args)
+
+	return goeve.SSH(labArg(fs, 0), *configFile)
+}
+
+// tunnelCommand handles: tunnel [--http_port] [--https_port] [--console_ports] [lab]
+func tunnelCommand(args []string) error {
+	fs := flag.NewFlagSet("tunnel", flag.ExitOnError)
+	httpPort := fs.Int("http_port", 8080, "local port forwarded to the eve-ng web ui http port")
+	httpsPort := fs.Int("https_port", 8443, "local port forwarded to the eve-ng web ui https port")
+	consolePorts := fs.String("console_ports", "32769-32868", "range of node telnet console ports forwarded to the same local ports")
+	fs.Parse(args)
+
+	return goeve.Tunnel(labArg(fs, 0), *configFile, *httpPort, *httpsPort, *consolePorts)
+}
+
+// syncCommand handles: sync [--sudo] [--lab] push|pull <local> <remote>
+func syncCommand(args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	sudo := fs.Bool("sudo", false, "read and write the remote files as root")
+	lab := fs.String("lab", *instanceName, "name of the lab compute instance")
+	fs.Parse(args)
+
+	if fs.NArg() != 3 {
+		return fmt.Errorf("usage: sync [--sudo] [--lab=name] push|pull <local> <remote>")
+	}
+
+	out, err := goeve.Sync(*lab, *configFile, fs.Arg(0), fs.Arg(1), fs.Arg(2), *sudo)
+	if err != nil {
+		return err
+	}
+
+	return printJSON(out)
+}
+
+// credentialsCommand handles: credentials [lab]
+func credentialsCommand(args []string) error {
+	fs := flag.NewFlagSet("credentials", flag.ExitOnError)
+	fs.Parse(args)
+
+	out, err := goeve.GetCredentials(labArg(fs, 0), *configFile)
+	if err != nil {
+		return err
+	}
+
+	return printJSON(out)
+}
+
+// verifyCommand handles: verify [lab]
+func verifyCommand(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	fs.Parse(args)
+
+	out, err := goeve.Verify(labArg(fs, 0), *configFile)
+	if out != nil {
+		if err := printJSON(out); err != nil {
+			return err
+		}
+	}
+
+	return err
+}
+
+// versionCommand handles: version [--remote] [lab]
+func versionCommand(args []string) error {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	remote := fs.Bool("remote", false, "show the eve-ng and host software versions of the lab")
+	fs.Parse(args)
+
+	if !*remote {
+		fmt.Println(version)
+		return nil
+	}
+
+	out, err := goeve.RemoteVersions(labArg(fs, 0), *configFile)
+	if err != nil {
+		return err
+	}
+
+	return printJSON(out)
+}
+
+// labCommands are the subcommands of lab, managing the eve-ng labs and folders.
+var labCommands = map[string]command{
+	"list":   labListCommand,
+	"create": labCreateCommand,
+	"delete": labDeleteCommand,
+	"move":   labMoveCommand,
+	"apply":  labApplyCommand,
+	"export": labExportCommand,
+	"import": labImportCommand,
+}
+
+// labCommand handles: lab list|create|delete|move|apply|export|import ...
+func labCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: lab list|create|delete|move|apply|export|import ...")
+	}
+
+	cmd, ok := labCommands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown lab command %q", args[0])
+	}
+
+	return cmd(args[1:])
+}
+
+// labListCommand handles: lab list [--lab] [folder]
+func labListCommand(args []string) error {
+	fs := flag.NewFlagSet("lab list", flag.ExitOnError)
+	lab := fs.String("lab", *instanceName, "name of the lab compute instance")
+	fs.Parse(args)
+
+	folder := "/"
+	if fs.NArg() > 0 {
+		folder = fs.Arg(0)
+	}
+
+	out, err := goeve.ListLabs(*lab, *configFile, folder)
+	if err != nil {
+		return err
+	}
+
+	return printJSON(out)
+}
+
+// labCreateCommand handles: lab create [--lab] [--author] [--description] <path>
+func labCreateCommand(args []string) error {
+	fs := flag.NewFlagSet("lab create", flag.ExitOnError)
+	lab := fs.String("lab", *instanceName, "name of the lab compute instance")
+	author := fs.String("author", "", "author of the eve-ng lab")
+	description := fs.String("description", "", "description of the eve-ng lab")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: lab create [--lab=name] [--author=name] [--description=text] <folder|lab.unl>")
+	}
+
+	out, err := goeve.CreateLab(*lab, *configFile, fs.Arg(0), *author, *description)
+	if err != nil {
+		return err
+	}
+
+	return printJSON(out)
+}
+
+// labDeleteCommand handles: lab delete [--lab] <path>
+func labDeleteCommand(args []string) error {
+	fs := flag.NewFlagSet("lab delete", flag.ExitOnError)
+	lab := fs.String("lab", *instanceName, "name of the lab compute instance")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: lab delete [--lab=name] <folder|lab.unl>")
+	}
+
+	out, err := goeve.DeleteLab(*lab, *configFile, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	return printJSON(out)
+}
+
+// labMoveCommand handles: lab move [--lab] <path> <destination>
+func labMoveCommand(args []string) error {
+	fs := flag.NewFlagSet("lab move", flag.ExitOnError)
+	lab := fs.String("lab", *instanceName, "name of the lab compute instance")
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		return fmt.Errorf("usage: lab move [--lab=name] <lab.unl> <folder> | <folder> <new folder path>")
+	}
+
+	out, err := goeve.MoveLab(*lab, *configFile, fs.Arg(0), fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	return printJSON(out)
+}
+
+// nodeCommand handles: node add|list|start|stop|wipe|delete [--lab] <eve-ng lab> [node...]
+func nodeCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: node add|list|start|stop|wipe|delete [--lab=name] [--all] <eve-ng lab> [node...]")
+	}
+
+	action := args[0]
+
+	fs := flag.NewFlagSet("node "+action, flag.ExitOnError)
+	lab := fs.String("lab", *instanceName, "name of the lab compute instance")
+
+	all := fs.Bool("all", false, "act on all the nodes of the lab")
+
+	var n eveapi.Node
+	if action == "add" {
+		fs.StringVar(&n.Name, "name", "", "node name")
+		fs.StringVar(&n.Template, "template", "", "node template, e.g. vios")
+		fs.StringVar(&n.Type, "type", "qemu", "node type: qemu, iol, dynamips or docker")
+		fs.StringVar(&n.Image, "image", "", "node image, default the template one")
+		fs.StringVar(&n.Icon, "icon", "", "node icon, e.g. Router.png")
+		fs.IntVar(&n.CPU, "cpu", 0, "number of cpus, default the template one")
+		fs.IntVar(&n.RAM, "ram", 0, "ram in MB, default the template one")
+		fs.IntVar(&n.Ethernet, "ethernet", 0, "number of ethernet interfaces, default the template one")
+		fs.IntVar(&n.Left, "left", 0, "horizontal position in the topology, in pixels")
+		fs.IntVar(&n.Top, "top", 0, "vertical position in the topology, in pixels")
+	}
+	fs.Parse(args[1:])
+
+	if fs.NArg() < 1 {
+		return fmt.Errorf("usage: node %v [--lab=name] <eve-ng lab> [node...]", action)
+	}
+
+	switch action {
+	case "add":
+		if n.Template == "" {
+			return fmt.Errorf("node add needs a --template")
+		}
+
+		out, err := goeve.AddNode(*lab, *configFile, fs.Arg(0), n)
+		if err != nil {
+			return err
+		}
+
+		return printJSON(out)
+	case "list":
+		out, err := goeve.ListNodes(*lab, *configFile, fs.Arg(0))
+		if err != nil {
+			return err
+		}
+
+		return printJSON(out)
+	case "start", "stop", "wipe", "delete":
+		// The results are printed even when some nodes failed.
+		out, err := goeve.NodeAction(*lab, *configFile, fs.Arg(0), action, fs.Args()[1:], *all)
+		if out != nil {
+			if err := printJSON(out); err != nil {
+				return err
+			}
+		}
+
+		return err
+	}
+
+	return fmt.Errorf("unknown node command %q", action)
+}
+
+// labApplyCommand handles: lab apply [--lab] [--prune] [--dry_run] [--yes] <topology.yaml>
+func labApplyCommand(args []string) error {
+	fs := flag.NewFlagSet("lab apply", flag.ExitOnError)
+	lab := fs.String("lab", *instanceName, "name of the lab compute instance")
+	prune := fs.Bool("prune", false, "delete the nodes, networks and links the topology does not describe")
+	dryRun := fs.Bool("dry_run", false, "only show the plan")
+	yes := fs.Bool("yes", false, "apply a plan which deletes or replaces lab objects without asking")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: lab apply [--lab=name] [--prune] [--dry_run] [--yes] <topology.yaml>")
+	}
+
+	// The plan is printed even when applying it failed.
+	out, err := goeve.ApplyTopology(*lab, *configFile, fs.Arg(0), *prune, *dryRun, func(r *goeve.ApplyResult) bool {
+		return confirmPlan(r, *yes)
+	})
+	if out != nil {
+		if err := printJSON(out); err != nil {
+			return err
+		}
+	}
+
+	return err
+}
+
+// confirmPlan shows the plan on stderr, before any of it runs, and asks to
+// apply it, unless yes is set.
+func confirmPlan(r *goeve.ApplyResult, yes bool) bool {
+	fmt.Fprintf(os.Stderr, "Plan for %v:\n", r.Lab)
+	for _, ch := range r.Changes {
+		fmt.Fprintf(os.Stderr, "  %v\n", ch)
+	}
+
+	if yes {
+		return true
+	}
+
+	fmt.Fprint(os.Stderr, "Apply these changes? [y/N] ")
+
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+
+	return false
+}
+
+// labExportCommand handles: lab export [--lab] <lab.unl> [file]
+func labExportCommand(args []string) error {
+	fs := flag.NewFlagSet("lab export", flag.ExitOnError)
+	lab := fs.String("lab", *instanceName, "name of the lab compute instance")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		return fmt.Errorf("usage: lab export [--lab=name] <lab.unl> [file]")
+	}
+
+	out, err := goeve.ExportLab(*lab, *configFile, fs.Arg(0), fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	return printJSON(out)
+}
+
+// labImportCommand handles: lab import [--lab] [--folder] [--new_id] [--force] <file>
+func labImportCommand(args []string) error {
+	fs := flag.NewFlagSet("lab import", flag.ExitOnError)
+	lab := fs.String("lab", *instanceName, "name of the lab compute instance")
+	folder := fs.String("folder", "/", "eve-ng folder to import the lab into")
+	newID := fs.Bool("new_id", false, "give the lab a new uuid, even if no other lab has its uuid")
+	force := fs.Bool("force", false, "replace an existing lab of the same name")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: lab import [--lab=name] [--folder=path] [--new_id] [--force] <file.unl>")
+	}
+
+	out, err := goeve.ImportLab(*lab, *configFile, fs.Arg(0), *folder, *newID, *force)
+	if err != nil {
+		return err
+	}
+
+	return printJSON(out)
+}
+
+// backupCommand handles: backup [--lab] [--dir] <eve-ng lab>
+func backupCommand(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	lab := fs.String("lab", *instanceName, "name of the lab compute instance")
+	dir := fs.String("dir", "eve-backups", "local git repository of the backups")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: backup [--lab=name] [--dir=path] <eve-ng lab>")
+	}
+
+	// The nodes are printed even when some could not be backed up.
+	out, err := goeve.Backup(*lab, *configFile, fs.Arg(0), *dir)
+	if out != nil {
+		if err := printJSON(out); err != nil {
+			return err
+		}
+	}
+
+	return err
+}
+
+// restoreCommand handles: restore [--lab] [--mapping] [--start] <eve-ng lab> <dir>
+func restoreCommand(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	lab := fs.String("lab", *instanceName, "name of the lab compute instance")
+	mapping := fs.String("mapping", "", "yaml file mapping the saved node names to the lab node names")
+	start := fs.Bool("start", false, "start the restored nodes")
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		return fmt.Errorf("usage: restore [--lab=name] [--mapping=file] [--start] <eve-ng lab> <dir>")
+	}
+
+	// The nodes are printed even when some could not be restored.
+	out, err := goeve.Restore(*lab, *configFile, fs.Arg(0), fs.Arg(1), *mapping, *start)
+	if out != nil {
+		if err := printJSON(out); err != nil {
+			return err
+		}
+	}
+
+	return err
+}
+
+// imageCommands are the subcommands of image, managing the eve-ng node images.
+var imageCommands = map[string]command{
+	"upload": imageUploadCommand,
+	"check":  imageCheckCommand,
+}
+
+// imageCommand handles: image upload|check ...
+func imageCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: image upload|check ...")
+	}
+
+	cmd, ok := imageCommands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown image command %q", args[0])
+	}
+
+	return cmd(args[1:])
+}
+
+// imageUploadCommand handles: image upload [--lab] --vendor --os --version [--disk] [--force] <file>
+// The file is converted to qcow2 when it is a VMDK, OVA or VHD image.
+func imageUploadCommand(args []string) error {
+	fs := flag.NewFlagSet("image upload", flag.ExitOnError)
+	lab := fs.String("lab", *instanceName, "name of the lab compute instance")
+	vendor := fs.String("vendor", "", "image vendor, e.g. cisco")
+	osName := fs.String("os", "", "image os, e.g. csr1000v")
+	version := fs.String("version", "", "image version, e.g. 17.3")
+	disk := fs.String("disk", "", "disk of the image the file is, default the boot disk")
+	force := fs.Bool("force", false, "replace an existing image disk")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 || *vendor == "" || *osName == "" || *version == "" {
+		return fmt.Errorf("usage: image upload [--lab=name] --vendor=name --os=name --version=version [--disk=name] [--force] <file>")
+	}
+
+	out, err := goeve.UploadImage(*lab, *configFile, fs.Arg(0), *vendor, *osName, *version, *disk, *force)
+	if err != nil {
+		return err
+	}
+
+	return printJSON(out)
+}
+
+// imageCheckCommand handles: image check [--lab] [--fix]
+func imageCheckCommand(args []string) error {
+	fs := flag.NewFlagSet("image check", flag.ExitOnError)
+	lab := fs.String("lab", *instanceName, "name of the lab compute instance")
+	fix := fs.Bool("fix", false, "rename the images go-eve knows the fix of")
+	fs.Parse(args)
+
+	out, err := goeve.CheckImages(*lab, *configFile, *fix)
+	if out != nil {
+		if err := printJSON(out); err != nil {
+			return err
+		}
+	}
+
+	return err
+}
+
+func printJSON(v interface{}) error {
+	s, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(s))
+
+	return nil
+}
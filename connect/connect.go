@@ -1,21 +1,38 @@
 package connect
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/briandowns/spinner"
 	"github.com/melbahja/goph"
+	"golang.org/x/crypto/ssh"
 )
 
+// rebootPollInterval is how often RebootAndWait tries to reach the rebooting host.
+var rebootPollInterval = 10 * time.Second
+
 // Functions all the operation for setting the compute instance.
 type Functions interface {
-	Fetch(string) error
-	RunScript(string) ([]byte, error)
+	Upload(string, []byte) error
+	UploadContext(context.Context, string, []byte) error
+	RunScript(string, time.Duration) ([]byte, error)
+	Run(string) ([]byte, error)
+	RunContext(context.Context, string) ([]byte, error)
+	Dial(string, string) (net.Conn, error)
 	Reboot() error
+	RebootAndWait(time.Duration) (Functions, error)
+	PinHostKeys(string) error
+	Shell() error
+	Forward(context.Context, []Port) error
+	Push(string, string, bool) (*SyncResult, error)
+	Pull(string, string, bool) (*SyncResult, error)
 }
 
 // Client represents a ssh gph.Client.
@@ -24,12 +41,14 @@ type Client struct {
 	publicKey  string
 	privateKey string
 	username   string
+	hostKey    ssh.HostKeyCallback
 	Service    *goph.Client
 }
 
 // NewClient construct a new ssh client connection.
-func NewClient(publicKey, privateKey, username string, ip net.Addr) (Functions, error) {
-	s, err := Connect(privateKey, username, ip)
+// The host key is verified with hostKey, a nil hostKey accepts any host key.
+func NewClient(publicKey, privateKey, username string, ip net.Addr, hostKey ssh.HostKeyCallback) (Functions, error) {
+	s, err := Connect(privateKey, username, ip, hostKey)
 	if err != nil {
 		return nil, err
 	}
@@ -39,6 +58,7 @@ func NewClient(publicKey, privateKey, username string, ip net.Addr) (Functions,
 		privateKey: privateKey,
 		username:   username,
 		ip:         ip,
+		hostKey:    hostKey,
 		Service:    s,
 	}
 
@@ -46,7 +66,7 @@ func NewClient(publicKey, privateKey, username string, ip net.Addr) (Functions,
 }
 
 // Connect handle the ssh connection to the remote compute instance.
-func Connect(privateKey, username string, ip net.Addr) (*goph.Client, error) {
+func Connect(privateKey, username string, ip net.Addr, hostKey ssh.HostKeyCallback) (*goph.Client, error) {
 	// Start new ssh connection with private key.
 	priKey, err := goph.Key(privateKey, "")
 	if err != nil {
@@ -62,7 +82,7 @@ func Connect(privateKey, username string, ip net.Addr) (*goph.Client, error) {
 		time.Sleep(20 * time.Second)
 		s.Stop()
 
-		client, err := goph.NewUnknown(username, ip.String(), priKey)
+		client, err := dial(priKey, username, ip, hostKey)
 		if err != nil {
 			c++
 		} else {
@@ -76,41 +96,131 @@ func Connect(privateKey, username string, ip net.Addr) (*goph.Client, error) {
 	}
 }
 
-// Fetch handles uploading files to the remote server.
-func (c Client) Fetch(file string) error {
-	dir, _ := os.Getwd()
+func dial(auth goph.Auth, username string, ip net.Addr, hostKey ssh.HostKeyCallback) (*goph.Client, error) {
+	if hostKey == nil {
+		hostKey = ssh.InsecureIgnoreHostKey()
+	}
 
-	log.Printf("Fetching file %v to server %v", file, c.ip.String())
+	return goph.NewConn(&goph.Config{
+		User:     username,
+		Addr:     ip.String(),
+		Port:     22,
+		Auth:     auth,
+		Timeout:  goph.DefaultTimeout,
+		Callback: hostKey,
+	})
+}
+
+// Upload handles uploading the content of a file to the remote server.
+// The file is written into the user's home directory, readable by the user
+// only, as the provisioning scripts may hold secrets.
+func (c Client) Upload(file string, content []byte) error {
+	return c.UploadContext(context.Background(), file, content)
+}
 
-	if err := c.Service.Upload(dir+"/"+file, "/home/"+c.username+"/"+file); err != nil {
-		return fmt.Errorf("could not fetch file %v, error: %v", file, err)
+// UploadContext is Upload, aborted when ctx is done.
+func (c Client) UploadContext(ctx context.Context, file string, content []byte) error {
+	log.Printf("Uploading file %v to server %v", file, c.ip.String())
+
+	ftp, err := c.Service.NewSftp()
+	if err != nil {
+		return fmt.Errorf("could not upload file %v, error: %v", file, err)
 	}
+	defer ftp.Close()
+	defer closeOnDone(ctx, ftp)()
 
-	log.Printf("Fetched file: %v", file)
+	remote, err := ftp.OpenFile("/home/"+c.username+"/"+file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("could not upload file %v, error: %v", file, err)
+	}
+	defer remote.Close()
+
+	// The mode is set before the content is written.
+	if err := remote.Chmod(0600); err != nil {
+		return fmt.Errorf("could not upload file %v, error: %v", file, err)
+	}
+
+	if _, err := remote.Write(content); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+
+		return fmt.Errorf("could not upload file %v, error: %v", file, err)
+	}
+
+	log.Printf("Uploaded file: %v", file)
 
 	return nil
 }
 
+// RunContext runs cmd on the remote compute instance, and returns its
+// combined output. The command is aborted when ctx is done.
+func (c Client) RunContext(ctx context.Context, cmd string) ([]byte, error) {
+	sess, err := c.Service.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer sess.Close()
+	defer closeOnDone(ctx, sess)()
+
+	out, err := sess.CombinedOutput(cmd)
+	if ctx.Err() != nil {
+		return out, ctx.Err()
+	}
+
+	return out, err
+}
+
+// closeOnDone closes cl when ctx is done, until the returned stop is called.
+func closeOnDone(ctx context.Context, cl io.Closer) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			cl.Close()
+		case <-done:
+		}
+	}()
+
+	return func() { close(done) }
+}
+
 // RunScript runs script on the remote compute instance.
-func (c Client) RunScript(file string) ([]byte, error) {
+// The script is killed when it runs longer than timeout, a timeout of 0 means no timeout.
+func (c Client) RunScript(file string, timeout time.Duration) ([]byte, error) {
 	// Execute your command.
 	log.Printf("Making %v executable.", file)
 
-	_, err := c.Service.Run("chmod +x /home/" + c.username + "/" + file)
+	_, err := c.Service.Run("chmod 700 /home/" + c.username + "/" + file)
 	if err != nil {
 		return nil, err
 	}
 
 	log.Printf("Running script on file %v", file)
 
-	out, err := c.Service.Run("sudo /home/" + c.username + "/" + file)
+	cmd := "sudo /home/" + c.username + "/" + file
+	if timeout > 0 {
+		cmd = fmt.Sprintf("sudo timeout --kill-after=30 %d /home/%v/%v", int(timeout.Seconds()), c.username, file)
+	}
+
+	out, err := c.Service.Run(cmd)
 	if err != nil {
-		return nil, err
+		return out, err
 	}
 
 	return out, nil
 }
 
+// Run runs the command cmd on the remote compute instance, and returns its combined output.
+func (c Client) Run(cmd string) ([]byte, error) {
+	return c.Service.Run(cmd)
+}
+
+// Dial opens a connection to the address addr, as seen from the remote compute instance.
+func (c Client) Dial(network, addr string) (net.Conn, error) {
+	return c.Service.Dial(network, addr)
+}
+
 // Reboot handles the rebooting of the remote compute instance.
 func (c Client) Reboot() error {
 	log.Println("Rebooting.")
@@ -123,3 +233,82 @@ func (c Client) Reboot() error {
 	log.Printf("Reboot status: %v", string(out))
 	return nil
 }
+
+// RebootAndWait reboots the remote compute instance and waits until it is back.
+// The host is only considered back once it answers ssh with a new boot id, so
+// a ssh server still running before the reboot is never mistaken for the
+// rebooted host. It returns a new connected client.
+func (c Client) RebootAndWait(timeout time.Duration) (Functions, error) {
+	priKey, err := goph.Key(c.privateKey, "")
+	if err != nil {
+		return nil, fmt.Errorf("Could not get privateKey: %v error: %v", c.privateKey, err)
+	}
+
+	bootID, err := readBootID(c.Service)
+	if err != nil {
+		return nil, fmt.Errorf("could not read boot id of %v, error: %v", c.ip.String(), err)
+	}
+
+	log.Printf("Rebooting %v, current boot id: %v", c.ip.String(), bootID)
+
+	// Detach the reboot, so the command returns before the connection drops.
+	if _, err := c.Service.Run("sudo sh -c 'sleep 2 && reboot -f' > /dev/null 2>&1 &"); err != nil {
+		return nil, err
+	}
+	c.Service.Close()
+
+	s := spinner.New(spinner.CharSets[9], 100*time.Millisecond) // Build our new spinner
+	s.Start()
+	defer s.Stop()
+
+	down := false
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(rebootPollInterval)
+
+		client, err := dial(priKey, c.username, c.ip, c.hostKey)
+		if err != nil {
+			if !down {
+				log.Printf("%v is down", c.ip.String())
+				down = true
+			}
+			continue
+		}
+
+		id, err := readBootID(client)
+		if err != nil || id == bootID {
+			client.Close()
+			continue
+		}
+
+		log.Printf("%v is back, new boot id: %v", c.ip.String(), id)
+
+		c.Service = client
+
+		return c, nil
+	}
+
+	return nil, fmt.Errorf("%v did not come back within %v", c.ip.String(), timeout)
+}
+
+// PinHostKeys pins in the knownHosts file the host keys the remote compute
+// instance has on disk, read over the current connection, whose host key was
+// verified. It follows the host keys a provisioning script regenerated, which
+// the ssh server only presents once restarted.
+func (c Client) PinHostKeys(knownHosts string) error {
+	out, err := c.Service.Run("cat /etc/ssh/ssh_host_*_key.pub")
+	if err != nil {
+		return fmt.Errorf("could not read the host keys of %v, error: %v, output: %s", c.ip.String(), err, out)
+	}
+
+	return ReplaceHostKeys(knownHosts, c.ip.String(), out)
+}
+
+func readBootID(s *goph.Client) (string, error) {
+	out, err := s.Run("cat /proc/sys/kernel/random/boot_id")
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,138 @@
+package connect
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// HostKeyCallback returns a ssh.HostKeyCallback pinning host keys in the knownHosts file.
+// The key of an unknown host is pinned on first use. If the key of a known host
+// changed, the connection is refused, unless trust is true, in which case the
+// new key replaces the pinned one. Trust is meant for instances go-eve just
+// (re)built, whose host keys are expected to change.
+func HostKeyCallback(knownHosts string, trust bool) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if err := os.MkdirAll(filepath.Dir(knownHosts), 0700); err != nil {
+			return err
+		}
+
+		f, err := os.OpenFile(knownHosts, os.O_CREATE|os.O_RDONLY, 0600)
+		if err != nil {
+			return err
+		}
+		f.Close()
+
+		check, err := knownhosts.New(knownHosts)
+		if err != nil {
+			return err
+		}
+
+		var keyErr *knownhosts.KeyError
+		if err := check(hostname, remote, key); !errors.As(err, &keyErr) {
+			return err
+		}
+
+		if len(keyErr.Want) > 0 {
+			if !trust {
+				return fmt.Errorf("host key of %v does not match the key pinned in %v, refusing to connect", hostname, knownHosts)
+			}
+
+			log.Printf("Replacing pinned host key of %v", hostname)
+
+			if err := forgetHost(knownHosts, hostname); err != nil {
+				return err
+			}
+		}
+
+		log.Printf("Pinning host key of %v in %v", hostname, knownHosts)
+
+		return pinHost(knownHosts, hostname, key)
+	}
+}
+
+// ReplaceHostKeys replaces the host keys pinned for host in the knownHosts file
+// with keys, in authorized_keys format, e.g. the content of the ssh server
+// public host key files.
+func ReplaceHostKeys(knownHosts, host string, keys []byte) error {
+	var parsed []ssh.PublicKey
+	for rest := keys; len(bytes.TrimSpace(rest)) > 0; {
+		key, _, _, r, err := ssh.ParseAuthorizedKey(rest)
+		if err != nil {
+			return fmt.Errorf("could not parse the host keys of %v, error: %v", host, err)
+		}
+
+		parsed = append(parsed, key)
+		rest = r
+	}
+
+	if len(parsed) == 0 {
+		return fmt.Errorf("no host key for %v", host)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(knownHosts), 0700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(knownHosts, os.O_CREATE|os.O_RDONLY, 0600)
+	if err != nil {
+		return err
+	}
+	f.Close()
+
+	if err := forgetHost(knownHosts, host); err != nil {
+		return err
+	}
+
+	log.Printf("Pinning the %d host keys of %v in %v", len(parsed), host, knownHosts)
+
+	for _, key := range parsed {
+		if err := pinHost(knownHosts, host, key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func pinHost(knownHosts, hostname string, key ssh.PublicKey) error {
+	f, err := os.OpenFile(knownHosts, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key) + "\n")
+
+	return err
+}
+
+func forgetHost(knownHosts, hostname string) error {
+	f, err := ioutil.ReadFile(knownHosts)
+	if err != nil {
+		return err
+	}
+
+	host := knownhosts.Normalize(hostname)
+
+	var lines []string
+	for _, l := range strings.Split(string(f), "\n") {
+		fields := strings.Fields(l)
+		if len(fields) > 0 && fields[0] == host {
+			continue
+		}
+
+		lines = append(lines, l)
+	}
+
+	return ioutil.WriteFile(knownHosts, []byte(strings.Join(lines, "\n")), 0600)
+}
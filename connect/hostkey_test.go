@@ -0,0 +1,123 @@
+package connect
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/crypto/ssh"
+)
+
+func newHostKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate a host key, error: %v", err)
+	}
+
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatalf("could not generate a host key, error: %v", err)
+	}
+
+	return key
+}
+
+func TestHostKeyCallback(t *testing.T) {
+	knownHosts := filepath.Join(t.TempDir(), "go-eve", "known_hosts")
+	remote := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 22}
+	first, changed := newHostKey(t), newHostKey(t)
+
+	line := func(key ssh.PublicKey) string {
+		return "192.0.2.1 " + string(ssh.MarshalAuthorizedKey(key))
+	}
+
+	// The tests run in order on the same known_hosts file.
+	tests := []struct {
+		name    string
+		key     ssh.PublicKey
+		trust   bool
+		wantErr bool
+		want    string
+	}{
+		{
+			name: "Passing first use pins the key",
+			key:  first,
+			want: line(first),
+		},
+		{
+			name: "Passing same key",
+			key:  first,
+			want: line(first),
+		},
+		{
+			name:    "Failing changed key",
+			key:     changed,
+			wantErr: true,
+			want:    line(first),
+		},
+		{
+			name:  "Passing trusted changed key replaces the pinned one",
+			key:   changed,
+			trust: true,
+			want:  line(changed),
+		},
+		{
+			name: "Passing replaced key",
+			key:  changed,
+			want: line(changed),
+		},
+	}
+
+	for _, tc := range tests {
+		err := HostKeyCallback(knownHosts, tc.trust)("192.0.2.1:22", remote, tc.key)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("HostKeyCallback() for %v returned error: %v, want error: %v", tc.name, err, tc.wantErr)
+		}
+
+		got, err := ioutil.ReadFile(knownHosts)
+		if err != nil {
+			t.Fatalf("could not read %v, error: %v", knownHosts, err)
+		}
+
+		if diff := cmp.Diff(tc.want, string(got)); diff != "" {
+			t.Errorf("HostKeyCallback() for %v left unexpected known hosts (-want +got):\n%s", tc.name, diff)
+		}
+	}
+}
+
+func TestReplaceHostKeys(t *testing.T) {
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	other, old, newKey, nextKey := newHostKey(t), newHostKey(t), newHostKey(t), newHostKey(t)
+
+	pinned := "192.0.2.2 " + string(ssh.MarshalAuthorizedKey(other)) + "192.0.2.1 " + string(ssh.MarshalAuthorizedKey(old))
+	if err := ioutil.WriteFile(knownHosts, []byte(pinned), 0600); err != nil {
+		t.Fatalf("could not write %v, error: %v", knownHosts, err)
+	}
+
+	keys := append(ssh.MarshalAuthorizedKey(newKey), ssh.MarshalAuthorizedKey(nextKey)...)
+	if err := ReplaceHostKeys(knownHosts, "192.0.2.1", keys); err != nil {
+		t.Fatalf("ReplaceHostKeys() returned error: %v", err)
+	}
+
+	got, err := ioutil.ReadFile(knownHosts)
+	if err != nil {
+		t.Fatalf("could not read %v, error: %v", knownHosts, err)
+	}
+
+	want := "192.0.2.2 " + string(ssh.MarshalAuthorizedKey(other)) + "192.0.2.1 " + string(ssh.MarshalAuthorizedKey(newKey)) + "192.0.2.1 " + string(ssh.MarshalAuthorizedKey(nextKey))
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("ReplaceHostKeys() left unexpected known hosts (-want +got):\n%s", diff)
+	}
+
+	for _, keys := range []string{"", "not a key\n"} {
+		if err := ReplaceHostKeys(knownHosts, "192.0.2.1", []byte(keys)); err == nil {
+			t.Errorf("ReplaceHostKeys() of %q returned no error", keys)
+		}
+	}
+}
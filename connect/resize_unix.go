@@ -0,0 +1,31 @@
+//go:build !windows
+// +build !windows
+
+package connect
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/term"
+)
+
+// watchResize calls resize with the new size of the terminal fd every time it
+// receives SIGWINCH, until done is closed.
+func watchResize(fd int, done <-chan struct{}, resize func(width, height int)) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGWINCH)
+	defer signal.Stop(sig)
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-sig:
+			if width, height, err := term.GetSize(fd); err == nil {
+				resize(width, height)
+			}
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package connect
+
+import (
+	"time"
+
+	"golang.org/x/term"
+)
+
+// watchResize polls the size of the terminal fd and calls resize every time it
+// changed, until done is closed. Windows has no SIGWINCH.
+func watchResize(fd int, done <-chan struct{}, resize func(width, height int)) {
+	width, height, _ := term.GetSize(fd)
+
+	t := time.NewTicker(500 * time.Millisecond)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+			w, h, err := term.GetSize(fd)
+			if err != nil || (w == width && h == height) {
+				continue
+			}
+
+			width, height = w, h
+			resize(width, height)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package connect
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// Shell opens an interactive shell on the remote compute instance.
+// The shell is attached to the local terminal, which is put in raw mode, and
+// the remote pty follows the local terminal size.
+func (c Client) Shell() error {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return fmt.Errorf("stdin is not a terminal")
+	}
+
+	sess, err := c.Service.NewSession()
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+
+	width, height, err := term.GetSize(fd)
+	if err != nil {
+		return err
+	}
+
+	termType := os.Getenv("TERM")
+	if termType == "" {
+		termType = "xterm-256color"
+	}
+
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+
+	if err := sess.RequestPty(termType, height, width, modes); err != nil {
+		return fmt.Errorf("could not request a pty on %v, error: %v", c.ip.String(), err)
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+
+	sess.Stdin = os.Stdin
+	sess.Stdout = os.Stdout
+	sess.Stderr = os.Stderr
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go watchResize(fd, done, func(width, height int) {
+		if err := sess.WindowChange(height, width); err != nil {
+			log.Printf("Could not resize the remote terminal, error: %v", err)
+		}
+	})
+
+	if err := sess.Shell(); err != nil {
+		return err
+	}
+
+	if err := sess.Wait(); err != nil {
+		if _, ok := err.(*ssh.ExitError); ok {
+			return nil
+		}
+
+		return err
+	}
+
+	return nil
+}
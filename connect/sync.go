@@ -0,0 +1,387 @@
+package connect
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SyncResult reports the files a Push or a Pull transferred or skipped.
+type SyncResult struct {
+	Transferred []string
+	Skipped     []string
+	Bytes       int64
+}
+
+// syncFile is a file to transfer, rel is its path relative to the synced directory.
+type syncFile struct {
+	rel  string
+	size int64
+	sum  string
+}
+
+// Push copies the local file or directory to the remote path, recursively.
+// A file pushed to an existing remote directory goes into it. Files whose
+// remote checksum matches the local one are skipped. If sudo is true, the
+// files are written as root, for destinations the ssh user cannot write.
+func (c Client) Push(local, remote string, sudo bool) (*SyncResult, error) {
+	files, err := localFiles(local)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(files) == 1 && files[0].rel == "" {
+		cmd := "test -d " + ShellQuote(remote)
+		if sudo {
+			cmd = "sudo " + cmd
+		}
+
+		if _, err := c.Service.Run(cmd); err == nil {
+			remote = path.Join(remote, filepath.Base(local))
+		}
+	}
+
+	sums, err := c.remoteSums(remote, sudo)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &SyncResult{}
+	p := newProgress(files, sums)
+
+	for _, f := range files {
+		dst := joinRemote(remote, f.rel)
+		if sums[f.rel] == f.sum {
+			r.Skipped = append(r.Skipped, dst)
+			continue
+		}
+
+		log.Printf("Pushing %v to %v", filepath.Join(local, f.rel), dst)
+
+		if err := c.push(filepath.Join(local, filepath.FromSlash(f.rel)), dst, sudo, p); err != nil {
+			return r, fmt.Errorf("could not push %v, error: %v", dst, err)
+		}
+
+		r.Transferred = append(r.Transferred, dst)
+		r.Bytes += f.size
+	}
+
+	return r, nil
+}
+
+// Pull copies the remote file or directory to the local path, recursively.
+// A file pulled to an existing local directory goes into it. Files whose local
+// checksum matches the remote one are skipped. If sudo is true, the files are
+// read as root, for sources the ssh user cannot read.
+func (c Client) Pull(remote, local string, sudo bool) (*SyncResult, error) {
+	sums, err := c.remoteSums(remote, sudo)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sums) == 0 {
+		return nil, fmt.Errorf("no files found at %v", remote)
+	}
+
+	if _, ok := sums[""]; ok {
+		local = LocalDest(local, remote)
+	}
+
+	var rels []string
+	for rel := range sums {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+
+	var files []syncFile
+	for _, rel := range rels {
+		f := syncFile{rel: rel, sum: sums[rel]}
+
+		if s, err := fileSum(filepath.Join(local, filepath.FromSlash(rel))); err == nil && s == f.sum {
+			f.sum = ""
+		}
+
+		files = append(files, f)
+	}
+
+	r := &SyncResult{}
+	p := newProgress(nil, nil)
+
+	for _, f := range files {
+		dst := filepath.Join(local, filepath.FromSlash(f.rel))
+		if f.sum == "" {
+			r.Skipped = append(r.Skipped, dst)
+			continue
+		}
+
+		src := joinRemote(remote, f.rel)
+		log.Printf("Pulling %v to %v", src, dst)
+
+		n, err := c.pull(src, dst, sudo, p)
+		if err != nil {
+			return r, fmt.Errorf("could not pull %v, error: %v", src, err)
+		}
+
+		r.Transferred = append(r.Transferred, dst)
+		r.Bytes += n
+	}
+
+	return r, nil
+}
+
+func (c Client) push(src, dst string, sudo bool, p *progress) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	in := io.TeeReader(f, p)
+
+	if sudo {
+		sess, err := c.Service.NewSession()
+		if err != nil {
+			return err
+		}
+		defer sess.Close()
+
+		sess.Stdin = in
+
+		cmd := fmt.Sprintf("sudo mkdir -p %v && sudo sh -c 'cat > \"$0\"' %v", ShellQuote(path.Dir(dst)), ShellQuote(dst))
+		if out, err := sess.CombinedOutput(cmd); err != nil {
+			return fmt.Errorf("%v: %s", err, out)
+		}
+
+		return nil
+	}
+
+	ftp, err := c.Service.NewSftp()
+	if err != nil {
+		return err
+	}
+	defer ftp.Close()
+
+	if err := ftp.MkdirAll(path.Dir(dst)); err != nil {
+		return err
+	}
+
+	remote, err := ftp.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer remote.Close()
+
+	_, err = io.Copy(remote, in)
+
+	return err
+}
+
+func (c Client) pull(src, dst string, sudo bool, p *progress) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return 0, err
+	}
+
+	local, err := os.Create(dst)
+	if err != nil {
+		return 0, err
+	}
+	defer local.Close()
+
+	out := io.MultiWriter(local, p)
+
+	if sudo {
+		sess, err := c.Service.NewSession()
+		if err != nil {
+			return 0, err
+		}
+		defer sess.Close()
+
+		w := &countWriter{w: out}
+		sess.Stdout = w
+
+		if err := sess.Run("sudo cat " + ShellQuote(src)); err != nil {
+			return 0, err
+		}
+
+		return w.n, nil
+	}
+
+	ftp, err := c.Service.NewSftp()
+	if err != nil {
+		return 0, err
+	}
+	defer ftp.Close()
+
+	remote, err := ftp.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer remote.Close()
+
+	return io.Copy(out, remote)
+}
+
+// remoteSums returns the sha256 checksum of every file under remote, keyed by
+// its path relative to remote. A missing remote path has no files.
+func (c Client) remoteSums(remote string, sudo bool) (map[string]string, error) {
+	cmd := "find " + ShellQuote(remote) + " -type f -exec sha256sum {} + 2> /dev/null || true"
+	if sudo {
+		cmd = "sudo sh -c " + ShellQuote(cmd)
+	}
+
+	out, err := c.Service.Run(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("could not checksum %v, error: %v", remote, err)
+	}
+
+	return parseSums(out, remote)
+}
+
+// parseSums parses the sha256sum output of the files under remote, keyed by
+// their path relative to remote, "" for remote itself.
+func parseSums(out []byte, remote string) (map[string]string, error) {
+	sums := map[string]string{}
+
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		fields := strings.SplitN(s.Text(), "  ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+
+		rel := strings.TrimPrefix(strings.TrimPrefix(fields[1], strings.TrimSuffix(remote, "/")), "/")
+		sums[rel] = fields[0]
+	}
+
+	return sums, s.Err()
+}
+
+// LocalDest returns the local path the remote file is pulled to: local, or
+// the file in it when local is an existing directory.
+func LocalDest(local, remote string) string {
+	if info, err := os.Stat(local); err == nil && info.IsDir() {
+		return filepath.Join(local, path.Base(remote))
+	}
+
+	return local
+}
+
+// localFiles returns the files under local, with their checksum.
+func localFiles(local string) ([]syncFile, error) {
+	var files []syncFile
+
+	err := filepath.Walk(local, func(p string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+
+		rel, err := filepath.Rel(local, p)
+		if err != nil {
+			return err
+		}
+
+		if rel == "." {
+			rel = ""
+		}
+
+		sum, err := fileSum(p)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, syncFile{rel: filepath.ToSlash(rel), size: info.Size(), sum: sum})
+
+		return nil
+	})
+
+	return files, err
+}
+
+func fileSum(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func joinRemote(remote, rel string) string {
+	if rel == "" {
+		return remote
+	}
+
+	return path.Join(remote, rel)
+}
+
+// ShellQuote quotes s for the remote shell.
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+
+	return n, err
+}
+
+// progress logs the transferred bytes, at most once per second.
+type progress struct {
+	total int64
+	done  int64
+	last  time.Time
+}
+
+// newProgress returns a progress for the files which are not already in sync.
+// A total of 0 means unknown.
+func newProgress(files []syncFile, sums map[string]string) *progress {
+	p := &progress{last: time.Now()}
+
+	for _, f := range files {
+		if sums[f.rel] != f.sum {
+			p.total += f.size
+		}
+	}
+
+	return p
+}
+
+func (p *progress) Write(b []byte) (int, error) {
+	p.done += int64(len(b))
+
+	if time.Since(p.last) < time.Second {
+		return len(b), nil
+	}
+	p.last = time.Now()
+
+	if p.total > 0 {
+		log.Printf("Transferred %d of %d MiB (%d%%)", p.done>>20, p.total>>20, p.done*100/p.total)
+		return len(b), nil
+	}
+
+	log.Printf("Transferred %d MiB", p.done>>20)
+
+	return len(b), nil
+}
@@ -0,0 +1,100 @@
+package connect
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseSums(t *testing.T) {
+	tests := []struct {
+		name   string
+		remote string
+		out    string
+		want   map[string]string
+	}{
+		{
+			name:   "Passing directory",
+			remote: "/opt/unetlab/addons/qemu/",
+			out:    "aaa  /opt/unetlab/addons/qemu/vios-15.6/virtioa.qcow2\nbbb  /opt/unetlab/addons/qemu/veos-4.26/my disk.qcow2\n",
+			want: map[string]string{
+				"vios-15.6/virtioa.qcow2": "aaa",
+				"veos-4.26/my disk.qcow2": "bbb",
+			},
+		},
+		{
+			name:   "Passing file",
+			remote: "/opt/unetlab/labs/ospf.unl",
+			out:    "ccc  /opt/unetlab/labs/ospf.unl\n",
+			want:   map[string]string{"": "ccc"},
+		},
+		{
+			name:   "Passing missing path",
+			remote: "/missing",
+			want:   map[string]string{},
+		},
+	}
+
+	for _, tc := range tests {
+		got, err := parseSums([]byte(tc.out), tc.remote)
+		if err != nil {
+			t.Fatalf("parseSums() for %v returned error: %v", tc.name, err)
+		}
+
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("parseSums() for %v returned unexpected diff (-want +got):\n%s", tc.name, diff)
+		}
+	}
+}
+
+func TestLocalFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range map[string]string{"a.txt": "a", "sub/b.txt": "bb"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []syncFile{
+		{rel: "a.txt", size: 1, sum: "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb"},
+		{rel: "sub/b.txt", size: 2, sum: "3b64db95cb55c763391c707108489ae18b4112d783300de38e033b4c98c3deaf"},
+	}
+
+	got, err := localFiles(dir)
+	if err != nil {
+		t.Fatalf("localFiles() returned error: %v", err)
+	}
+
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(syncFile{})); diff != "" {
+		t.Errorf("localFiles() returned unexpected diff (-want +got):\n%s", diff)
+	}
+
+	got, err = localFiles(filepath.Join(dir, "a.txt"))
+	if err != nil {
+		t.Fatalf("localFiles() of a file returned error: %v", err)
+	}
+
+	if diff := cmp.Diff([]syncFile{{rel: "", size: 1, sum: want[0].sum}}, got, cmp.AllowUnexported(syncFile{})); diff != "" {
+		t.Errorf("localFiles() of a file returned unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestLocalDest(t *testing.T) {
+	dir := t.TempDir()
+
+	if got, want := LocalDest(dir, "/opt/unetlab/labs/ospf.unl"), filepath.Join(dir, "ospf.unl"); got != want {
+		t.Errorf("LocalDest() of a directory returned %q, want %q", got, want)
+	}
+
+	file := filepath.Join(dir, "lab.unl")
+	if got := LocalDest(file, "/opt/unetlab/labs/ospf.unl"); got != file {
+		t.Errorf("LocalDest() of a new file returned %q, want %q", got, file)
+	}
+}
@@ -0,0 +1,165 @@
+package connect
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/melbahja/goph"
+	"golang.org/x/crypto/ssh"
+)
+
+// keepAliveInterval is how often Forward checks that the ssh connection is alive.
+var keepAliveInterval = 15 * time.Second
+
+// Port forwards the Local address to the Remote address, as seen from the compute instance.
+type Port struct {
+	Local  string
+	Remote string
+}
+
+// sharedConn is the ssh connection shared by all the forwarded ports.
+type sharedConn struct {
+	mu        sync.Mutex
+	client    *goph.Client
+	reconnect func() (*goph.Client, error)
+}
+
+func (s *sharedConn) get() *goph.Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.client
+}
+
+// reset replaces the broken connection with a new one. If broken was already
+// replaced, the current connection is returned.
+func (s *sharedConn) reset(broken *goph.Client) (*goph.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.client != broken {
+		return s.client, nil
+	}
+
+	broken.Close()
+
+	client, err := s.reconnect()
+	if err != nil {
+		return nil, err
+	}
+
+	s.client = client
+
+	return client, nil
+}
+
+// Forward forwards the connections accepted on the local address of every port
+// to its remote address over ssh, until ctx is done.
+// A broken ssh connection is reestablished. The ssh connection is closed when
+// Forward returns, even on error.
+func (c Client) Forward(ctx context.Context, ports []Port) error {
+	conn := &sharedConn{client: c.Service}
+	defer func() { conn.get().Close() }()
+
+	priKey, err := goph.Key(c.privateKey, "")
+	if err != nil {
+		return fmt.Errorf("Could not get privateKey: %v error: %v", c.privateKey, err)
+	}
+
+	conn.reconnect = func() (*goph.Client, error) {
+		log.Printf("Reconnecting to: %v", c.ip.String())
+		return dial(priKey, c.username, c.ip, c.hostKey)
+	}
+
+	for _, p := range ports {
+		l, err := net.Listen("tcp", p.Local)
+		if err != nil {
+			return fmt.Errorf("could not listen on %v, error: %v", p.Local, err)
+		}
+		defer l.Close()
+
+		go forward(l, p.Remote, conn)
+	}
+
+	keepAlive(ctx, conn)
+
+	return nil
+}
+
+// keepAlive checks the ssh connection, and reconnects when it is broken, until ctx is done.
+func keepAlive(ctx context.Context, conn *sharedConn) {
+	t := time.NewTicker(keepAliveInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		client := conn.get()
+		if _, _, err := client.SendRequest("keepalive@openssh.com", true, nil); err == nil {
+			continue
+		}
+
+		log.Printf("Lost the ssh connection to: %v", client.RemoteAddr())
+
+		if _, err := conn.reset(client); err != nil {
+			log.Printf("Could not reconnect, will retry, error: %v", err)
+		}
+	}
+}
+
+func forward(l net.Listener, remote string, conn *sharedConn) {
+	for {
+		local, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			defer local.Close()
+
+			client := conn.get()
+
+			r, err := client.Dial("tcp", remote)
+			if _, refused := err.(*ssh.OpenChannelError); err != nil && !refused {
+				// The ssh connection is broken, not the remote port.
+				if client, err = conn.reset(client); err == nil {
+					r, err = client.Dial("tcp", remote)
+				}
+			}
+
+			if err != nil {
+				log.Printf("Could not forward %v to %v, error: %v", l.Addr(), remote, err)
+				return
+			}
+			defer r.Close()
+
+			pipe(local, r)
+		}()
+	}
+}
+
+// pipe copies data both ways between a and b, until one of them is closed.
+func pipe(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+
+	go func() {
+		io.Copy(a, b)
+		done <- struct{}{}
+	}()
+
+	go func() {
+		io.Copy(b, a)
+		done <- struct{}{}
+	}()
+
+	<-done
+}
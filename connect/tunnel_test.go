@@ -0,0 +1,222 @@
+package connect
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/melbahja/goph"
+	"golang.org/x/crypto/ssh"
+)
+
+// newSSHServer starts a ssh server forwarding direct-tcpip channels, and
+// returns a Client connected to it.
+func newSSHServer(t *testing.T) Client {
+	t.Helper()
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate a host key, error: %v", err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("could not generate a host key, error: %v", err)
+	}
+
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(signer)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen, error: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go serveSSH(c, config)
+		}
+	}()
+
+	client, err := ssh.Dial("tcp", l.Addr().String(), &ssh.ClientConfig{HostKeyCallback: ssh.InsecureIgnoreHostKey()})
+	if err != nil {
+		t.Fatalf("could not connect to the ssh server, error: %v", err)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("could not generate a private key, error: %v", err)
+	}
+
+	privateKey := filepath.Join(t.TempDir(), "id_rsa")
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := ioutil.WriteFile(privateKey, pemKey, 0600); err != nil {
+		t.Fatalf("could not write the private key, error: %v", err)
+	}
+
+	return Client{ip: l.Addr(), privateKey: privateKey, Service: &goph.Client{Client: client}}
+}
+
+func serveSSH(c net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(c, config)
+	if err != nil {
+		return
+	}
+
+	go ssh.DiscardRequests(reqs)
+
+	for ch := range chans {
+		var target struct {
+			Host       string
+			Port       uint32
+			OriginHost string
+			OriginPort uint32
+		}
+
+		if ch.ChannelType() != "direct-tcpip" || ssh.Unmarshal(ch.ExtraData(), &target) != nil {
+			ch.Reject(ssh.UnknownChannelType, "only direct-tcpip")
+			continue
+		}
+
+		r, err := net.Dial("tcp", net.JoinHostPort(target.Host, fmt.Sprint(target.Port)))
+		if err != nil {
+			ch.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+
+		local, reqs, err := ch.Accept()
+		if err != nil {
+			r.Close()
+			continue
+		}
+
+		go ssh.DiscardRequests(reqs)
+		go func() {
+			defer local.Close()
+			defer r.Close()
+
+			go io.Copy(r, local)
+			io.Copy(local, r)
+		}()
+	}
+}
+
+// freeAddr returns a local address nothing listens on.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen, error: %v", err)
+	}
+	defer l.Close()
+
+	return l.Addr().String()
+}
+
+func TestForward(t *testing.T) {
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen, error: %v", err)
+	}
+	defer echo.Close()
+
+	go func() {
+		for {
+			c, err := echo.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer c.Close()
+				io.Copy(c, c)
+			}()
+		}
+	}()
+
+	c := newSSHServer(t)
+	local := freeAddr(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- c.Forward(ctx, []Port{{Local: local, Remote: echo.Addr().String()}})
+	}()
+
+	var conn net.Conn
+	for i := 0; i < 50; i++ {
+		if conn, err = net.Dial("tcp", local); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if err != nil {
+		t.Fatalf("Forward() did not listen on %v, error: %v", local, err)
+	}
+
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatalf("could not write to the forwarded port, error: %v", err)
+	}
+
+	got := make([]byte, 4)
+	if _, err := io.ReadFull(conn, got); err != nil || string(got) != "ping" {
+		t.Errorf("Forward() forwarded %q, error: %v, want %q", got, err, "ping")
+	}
+	conn.Close()
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Forward() returned error: %v", err)
+	}
+
+	if _, _, err := c.Service.SendRequest("keepalive@openssh.com", true, nil); err == nil {
+		t.Errorf("Forward() did not close the ssh connection")
+	}
+}
+
+func TestForwardListenError(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen, error: %v", err)
+	}
+	defer busy.Close()
+
+	c := newSSHServer(t)
+	first := freeAddr(t)
+
+	ports := []Port{
+		{Local: first, Remote: "127.0.0.1:80"},
+		{Local: busy.Addr().String(), Remote: "127.0.0.1:443"},
+	}
+
+	if err := c.Forward(context.Background(), ports); err == nil {
+		t.Fatalf("Forward() on a busy port returned no error")
+	}
+
+	if _, _, err := c.Service.SendRequest("keepalive@openssh.com", true, nil); err == nil {
+		t.Errorf("Forward() did not close the ssh connection")
+	}
+
+	if conn, err := net.Dial("tcp", first); err == nil {
+		conn.Close()
+		t.Errorf("Forward() left %v listening", first)
+	}
+}
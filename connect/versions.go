@@ -0,0 +1,56 @@
+package connect
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Versions are the eve-ng and host software versions of the compute instance.
+type Versions struct {
+	EveNG  string
+	Kernel string
+	QEMU   string
+	Ubuntu string
+}
+
+// versionCommands print the versions, an empty output means not installed.
+// When both eve-ng packages are installed, after an upgrade from the community
+// edition, the pro one is the running edition.
+var versionCommands = []struct {
+	cmd string
+	set func(v *Versions, s string)
+}{
+	{
+		cmd: `dpkg-query -W -f='${Status} ${Package} ${Version}\n' eve-ng-pro eve-ng 2> /dev/null | awk '$3 == "installed" {v[$4] = $4 " " $5} END {if ("eve-ng-pro" in v) print v["eve-ng-pro"]; else if ("eve-ng" in v) print v["eve-ng"]}'`,
+		set: func(v *Versions, s string) { v.EveNG = s },
+	},
+	{
+		cmd: "uname -r",
+		set: func(v *Versions, s string) { v.Kernel = s },
+	},
+	{
+		cmd: "(/opt/qemu/bin/qemu-system-x86_64 --version || qemu-system-x86_64 --version) 2> /dev/null | head -1",
+		set: func(v *Versions, s string) { v.QEMU = s },
+	},
+	{
+		cmd: "lsb_release -ds",
+		set: func(v *Versions, s string) { v.Ubuntu = s },
+	},
+}
+
+// GetVersions collects the eve-ng, kernel, qemu and ubuntu versions of the
+// compute instance over ssh.
+func GetVersions(f Functions) (*Versions, error) {
+	v := &Versions{}
+
+	for _, c := range versionCommands {
+		out, err := f.Run(c.cmd)
+		if err != nil {
+			return nil, fmt.Errorf("could not get versions with %q, error: %v", c.cmd, err)
+		}
+
+		c.set(v, strings.TrimSpace(string(out)))
+	}
+
+	return v, nil
+}
@@ -0,0 +1,58 @@
+package connect
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEveNGVersionCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		packages string
+		want     string
+	}{
+		{
+			name:     "Passing community",
+			packages: "install ok installed eve-ng 2.0.3-112\n",
+			want:     "eve-ng 2.0.3-112",
+		},
+		{
+			name:     "Passing pro upgraded from community",
+			packages: "install ok installed eve-ng 2.0.3-112\ninstall ok installed eve-ng-pro 5.0.1-19\n",
+			want:     "eve-ng-pro 5.0.1-19",
+		},
+		{
+			name:     "Passing removed community",
+			packages: "deinstall ok config-files eve-ng 2.0.3-112\ninstall ok installed eve-ng-pro 5.0.1-19\n",
+			want:     "eve-ng-pro 5.0.1-19",
+		},
+		{
+			name: "Passing not installed",
+		},
+	}
+
+	for _, tc := range tests {
+		// A dpkg-query printing the packages.
+		bin := t.TempDir()
+		script := "#!/bin/sh\nprintf '" + strings.ReplaceAll(tc.packages, "\n", `\n`) + "'\n"
+		if err := ioutil.WriteFile(filepath.Join(bin, "dpkg-query"), []byte(script), 0755); err != nil {
+			t.Fatalf("could not write dpkg-query, error: %v", err)
+		}
+
+		cmd := exec.Command("sh", "-c", versionCommands[0].cmd)
+		cmd.Env = append(os.Environ(), "PATH="+bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("version command for %v returned error: %v", tc.name, err)
+		}
+
+		if got := strings.TrimSpace(string(out)); got != tc.want {
+			t.Errorf("version command for %v returned %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
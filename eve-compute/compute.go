@@ -27,6 +27,7 @@ type ServiceFunctions interface {
 	DeleteInstance(string, string, string) error
 	StopInstance(string, string, string) error
 	StartInstance(string, string, string) error
+	GuestAttributes(string, string, string, string) (map[string]string, error)
 }
 
 type computeService struct {
@@ -305,3 +306,23 @@ func (c computeService) StartInstance(projectID, zone, name string) error {
 
 	return nil
 }
+
+// GuestAttributes returns the guest attributes the compute instance set under queryPath, keyed by name.
+func (c computeService) GuestAttributes(projectID, zone, name, queryPath string) (map[string]string, error) {
+	op, err := c.service.Instances.GetGuestAttributes(projectID, zone, name).QueryPath(queryPath).Do()
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := map[string]string{}
+
+	if op.QueryValue == nil {
+		return attrs, nil
+	}
+
+	for _, i := range op.QueryValue.Items {
+		attrs[i.Key] = i.Value
+	}
+
+	return attrs, nil
+}
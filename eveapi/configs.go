@@ -0,0 +1,48 @@
+package eveapi
+
+import (
+	"net/http"
+	"strconv"
+)
+
+func configPath(lab string, id int) string {
+	return "labs/" + escapePath(lab) + "/configs/" + strconv.Itoa(id)
+}
+
+// ExportConfig saves the running configuration of the node id as its startup
+// configuration in the lab. Not every template supports it.
+func (c *Client) ExportConfig(lab string, id int) error {
+	return c.do(http.MethodPut, nodePath(lab, id)+"/export", nil, nil)
+}
+
+// Config returns the startup configuration of the node id, saved in the lab.
+func (c *Client) Config(lab string, id int) (string, error) {
+	var out struct {
+		Data string `json:"data"`
+	}
+	if err := c.do(http.MethodGet, configPath(lab, id), nil, &out); err != nil {
+		return "", err
+	}
+
+	return out.Data, nil
+}
+
+// SetConfig replaces the startup configuration of the node id saved in the lab.
+func (c *Client) SetConfig(lab string, id int, config string) error {
+	in := map[string]string{"id": strconv.Itoa(id), "data": config}
+
+	return c.do(http.MethodPut, configPath(lab, id), in, nil)
+}
+
+// UseConfig sets whether the node id boots with its startup configuration
+// saved in the lab, rather than the template default.
+func (c *Client) UseConfig(lab string, id int, use bool) error {
+	config := "0"
+	if use {
+		config = "1"
+	}
+
+	in := map[string]interface{}{"id": id, "config": config}
+
+	return c.do(http.MethodPut, nodePath(lab, id), in, nil)
+}
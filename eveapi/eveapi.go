@@ -0,0 +1,142 @@
+// Package eveapi is a client of the eve-ng REST API.
+package eveapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+)
+
+// Client is an eve-ng API client. Its session is kept in a cookie, set by Login.
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+// Error is an error returned by the eve-ng API.
+type Error struct {
+	// Code is the http status code.
+	Code    int    `json:"code"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("eve-ng api error %d %v: %v", e.Code, e.Status, e.Message)
+}
+
+// response is the envelope of every eve-ng API response.
+type response struct {
+	Code    int             `json:"code"`
+	Status  string          `json:"status"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// New returns a client of the eve-ng API at baseURL, e.g. http://127.0.0.1.
+// The requests go through hc, nil means http.DefaultClient.
+func New(baseURL string, hc *http.Client) (*Client, error) {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Copy hc, to keep the session cookies to this client.
+	h := *hc
+	h.Jar = jar
+
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		http:    &h,
+	}, nil
+}
+
+// do sends a request to the API path, with in encoded as the json body when
+// not nil, and decodes the response data into out when not nil.
+func (c *Client) do(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+"/api/"+path, body)
+	if err != nil {
+		return err
+	}
+
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not %v %v, error: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	var r response
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return fmt.Errorf("could not decode the %v %v response, status: %v, error: %v", method, path, resp.Status, err)
+	}
+
+	if resp.StatusCode >= 400 || r.Status == "fail" || r.Status == "error" || r.Status == "unauthorized" {
+		if r.Code == 0 {
+			r.Code = resp.StatusCode
+		}
+
+		return &Error{Code: r.Code, Status: r.Status, Message: r.Message}
+	}
+
+	// eve-ng sends an empty list, not an empty object, for a lab without
+	// nodes or networks.
+	if out == nil || len(r.Data) == 0 || string(bytes.TrimSpace(r.Data)) == "[]" {
+		return nil
+	}
+
+	if err := json.Unmarshal(r.Data, out); err != nil {
+		return fmt.Errorf("could not decode the %v %v data, error: %v", method, path, err)
+	}
+
+	return nil
+}
+
+// escapePath escapes every element of the slash separated path p.
+func escapePath(p string) string {
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	for i, s := range parts {
+		parts[i] = url.PathEscape(s)
+	}
+
+	return strings.Join(parts, "/")
+}
+
+// Login opens a session as user.
+func (c *Client) Login(username, password string) error {
+	in := map[string]string{
+		"username": username,
+		"password": password,
+		// Sessions of the native console, not of the html5 one.
+		"html5": "-1",
+	}
+
+	return c.do(http.MethodPost, "auth/login", in, nil)
+}
+
+// Logout closes the session.
+func (c *Client) Logout() error {
+	return c.do(http.MethodGet, "auth/logout", nil, nil)
+}
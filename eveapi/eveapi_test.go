@@ -0,0 +1,489 @@
+package eveapi
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeAPI is a fake of the eve-ng API, serving canned data to logged in
+// sessions, keyed by method and path, and recording the request bodies.
+type fakeAPI struct {
+	data     map[string]string
+	requests map[string]string
+}
+
+func (f fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reply := func(code int, status, message, data string) {
+		if data == "" {
+			data = "null"
+		}
+
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(response{Code: code, Status: status, Message: message, Data: json.RawMessage(data)})
+	}
+
+	switch r.URL.Path {
+	case "/api/auth/login":
+		var in map[string]string
+		json.NewDecoder(r.Body).Decode(&in)
+		if in["username"] != "admin" || in["password"] != "eve" {
+			reply(http.StatusBadRequest, "fail", "Cannot authenticate (90017).", "")
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "unetlab_session", Value: "s1", Path: "/api/"})
+		reply(http.StatusOK, "success", "User logged in (90013).", "")
+		return
+	}
+
+	if c, err := r.Cookie("unetlab_session"); err != nil || c.Value != "s1" {
+		reply(http.StatusUnauthorized, "unauthorized", "User is not authenticated or session timed out (90001).", "")
+		return
+	}
+
+	key := r.Method + " " + r.URL.Path
+	if b, _ := ioutil.ReadAll(r.Body); len(b) > 0 {
+		f.requests[key] = string(b)
+	}
+
+	data, ok := f.data[key]
+	if !ok {
+		reply(http.StatusNotFound, "fail", "Not found.", "")
+		return
+	}
+
+	reply(http.StatusOK, "success", "ok", data)
+}
+
+func newTestClient(t *testing.T) (*Client, map[string]string) {
+	t.Helper()
+
+	api := fakeAPI{
+		data: map[string]string{
+			"GET /api/auth/logout":                           "",
+			"GET /api/status":                                `{"version":"2.0.3-112","qemu_version":"2.4.0","cpu":3,"disk":12,"mem":20.5,"swap":0,"iol":0,"dynamips":0,"qemu":2}`,
+			"GET /api/list/templates/":                       `{"vios":"Cisco vIOS Router","csr1000vng.missing":"Cisco CSR 1000V (Denali and Everest).missing"}`,
+			"GET /api/folders/":                              `{"folders":[{"name":"..","path":"/"},{"name":"team","path":"/team"}],"labs":[{"file":"ospf.unl","path":"/ospf.unl","mtime":"04 Oct 2021 10:00"}]}`,
+			"GET /api/folders/my team":                       `{"folders":[],"labs":[]}`,
+			"GET /api/labs/team/ospf.unl":                    `{"id":"4e5b1d72-1c8f-4f2c-9d4e-2a7a5c0e9f11","name":"ospf","filename":"ospf.unl","author":"eve","description":"","body":"","version":"1"}`,
+			"POST /api/folders":                              "",
+			"DELETE /api/folders/team":                       "",
+			"PUT /api/folders/team":                          "",
+			"POST /api/labs":                                 "",
+			"DELETE /api/labs/team/ospf.unl":                 "",
+			"PUT /api/labs/team/ospf.unl/move":               "",
+			"GET /api/labs/team/ospf.unl/nodes":              `{"2":{"id":2,"name":"R2","type":"qemu","template":"vios","image":"vios-15.6","cpu":1,"ram":1024,"ethernet":4,"left":300,"top":100,"status":2},"1":{"id":"1","name":"R1","type":"qemu","template":"vios","image":"vios-15.6","cpu":"1","ram":"1024","ethernet":"4","left":"35%","top":"25%","status":0}}`,
+			"POST /api/labs/team/ospf.unl/nodes":             `{"id":3}`,
+			"GET /api/labs/team/ospf.unl/nodes/1/start":      "",
+			"GET /api/labs/team/ospf.unl/nodes/1/stop":       "",
+			"GET /api/labs/team/ospf.unl/nodes/1/wipe":       "",
+			"DELETE /api/labs/team/ospf.unl/nodes/1":         "",
+			"PUT /api/labs/team/ospf.unl/nodes/1":            "",
+			"GET /api/labs/team/ospf.unl/nodes/1/interfaces": `{"id":1,"sort":"qemu","ethernet":[{"name":"Gi0/0","network_id":1},{"name":"Gi0/1","network_id":0}],"serial":[]}`,
+			"GET /api/labs/team/ospf.unl/nodes/2/interfaces": `{"id":2,"sort":"iol","ethernet":{"16":{"name":"e1/0","network_id":"2"},"0":{"name":"e0/0","network_id":"0"}},"serial":[]}`,
+			"PUT /api/labs/team/ospf.unl/nodes/1/interfaces": "",
+			"GET /api/labs/team/ospf.unl/networks":           `{"1":{"id":1,"name":"mgmt","type":"pnet1","left":"300","top":"50","visibility":"1"}}`,
+			"POST /api/labs/team/ospf.unl/networks":          `{"id":2}`,
+			"DELETE /api/labs/team/ospf.unl/networks/1":      "",
+			"PUT /api/labs/team/ospf.unl/nodes/1/export":     "",
+			"GET /api/labs/team/ospf.unl/configs/1":          `{"id":1,"name":"R1","data":"hostname R1\n"}`,
+			"PUT /api/labs/team/ospf.unl/configs/1":          "",
+			"GET /api/labs/team/empty.unl/nodes":             `[]`,
+			"GET /api/labs/team/empty.unl/networks":          `[]`,
+		},
+		requests: map[string]string{},
+	}
+
+	s := httptest.NewServer(api)
+	t.Cleanup(s.Close)
+
+	c, err := New(s.URL, s.Client())
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+
+	return c, api.requests
+}
+
+func TestLogin(t *testing.T) {
+	c, _ := newTestClient(t)
+
+	var apiErr *Error
+	if _, err := c.Status(); !errors.As(err, &apiErr) || apiErr.Code != http.StatusUnauthorized {
+		t.Errorf("Status() before Login() returned error: %v, want an unauthorized *Error", err)
+	}
+
+	if err := c.Login("admin", "wrong"); !errors.As(err, &apiErr) || apiErr.Status != "fail" {
+		t.Errorf("Login() with a wrong password returned error: %v, want a fail *Error", err)
+	}
+
+	if err := c.Login("admin", "eve"); err != nil {
+		t.Fatalf("Login() returned error: %v", err)
+	}
+
+	if _, err := c.Status(); err != nil {
+		t.Errorf("Status() after Login() returned error: %v", err)
+	}
+
+	if err := c.Logout(); err != nil {
+		t.Errorf("Logout() returned error: %v", err)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	c, _ := newTestClient(t)
+	if err := c.Login("admin", "eve"); err != nil {
+		t.Fatalf("Login() returned error: %v", err)
+	}
+
+	want := &SystemStatus{Version: "2.0.3-112", QEMUVersion: "2.4.0", CPU: 3, Disk: 12, Mem: 20.5, QEMU: 2}
+
+	got, err := c.Status()
+	if err != nil {
+		t.Fatalf("Status() returned error: %v", err)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Status() returned unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	c, _ := newTestClient(t)
+	if err := c.Login("admin", "eve"); err != nil {
+		t.Fatalf("Login() returned error: %v", err)
+	}
+
+	want := []Template{
+		{Name: "csr1000vng.missing", Description: "Cisco CSR 1000V (Denali and Everest).missing"},
+		{Name: "vios", Description: "Cisco vIOS Router"},
+	}
+
+	got, err := c.Templates()
+	if err != nil {
+		t.Fatalf("Templates() returned error: %v", err)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Templates() returned unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestFolder(t *testing.T) {
+	c, _ := newTestClient(t)
+	if err := c.Login("admin", "eve"); err != nil {
+		t.Fatalf("Login() returned error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		want    *Folder
+		wantErr bool
+	}{
+		{
+			name: "Passing root folder",
+			path: "/",
+			want: &Folder{
+				Folders: []FolderEntry{{Name: "team", Path: "/team"}},
+				Labs:    []LabEntry{{File: "ospf.unl", Path: "/ospf.unl", MTime: "04 Oct 2021 10:00"}},
+			},
+		},
+		{
+			name: "Passing escaped folder",
+			path: "/my team",
+			want: &Folder{Labs: []LabEntry{}},
+		},
+		{
+			name:    "Failing missing folder",
+			path:    "/missing",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		got, err := c.Folder(tc.path)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("Folder() for %v returned error: %v, want error: %v", tc.name, err, tc.wantErr)
+		}
+
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("Folder() for %v returned unexpected diff (-want +got):\n%s", tc.name, diff)
+		}
+	}
+}
+
+func TestLab(t *testing.T) {
+	c, _ := newTestClient(t)
+	if err := c.Login("admin", "eve"); err != nil {
+		t.Fatalf("Login() returned error: %v", err)
+	}
+
+	want := &Lab{ID: "4e5b1d72-1c8f-4f2c-9d4e-2a7a5c0e9f11", Name: "ospf", Filename: "ospf.unl", Author: "eve", Version: "1"}
+
+	got, err := c.Lab("/team/ospf.unl")
+	if err != nil {
+		t.Fatalf("Lab() returned error: %v", err)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Lab() returned unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestLabChanges(t *testing.T) {
+	c, requests := newTestClient(t)
+	if err := c.Login("admin", "eve"); err != nil {
+		t.Fatalf("Login() returned error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		change  func() error
+		key     string
+		wantReq string
+	}{
+		{
+			name:    "Passing create folder",
+			change:  func() error { return c.CreateFolder("/", "team") },
+			key:     "POST /api/folders",
+			wantReq: `{"name":"team","path":"/"}`,
+		},
+		{
+			name:   "Passing delete folder",
+			change: func() error { return c.DeleteFolder("/team") },
+			key:    "DELETE /api/folders/team",
+		},
+		{
+			name:    "Passing move folder",
+			change:  func() error { return c.MoveFolder("/team", "/archive/team") },
+			key:     "PUT /api/folders/team",
+			wantReq: `{"path":"/archive/team"}`,
+		},
+		{
+			name:    "Passing create lab",
+			change:  func() error { return c.CreateLab("/team", Lab{Name: "ospf", Author: "eve"}) },
+			key:     "POST /api/labs",
+			wantReq: `{"author":"eve","body":"","description":"","name":"ospf","path":"/team","version":"1"}`,
+		},
+		{
+			name:   "Passing delete lab",
+			change: func() error { return c.DeleteLab("/team/ospf.unl") },
+			key:    "DELETE /api/labs/team/ospf.unl",
+		},
+		{
+			name:    "Passing move lab",
+			change:  func() error { return c.MoveLab("/team/ospf.unl", "/archive") },
+			key:     "PUT /api/labs/team/ospf.unl/move",
+			wantReq: `{"path":"/archive"}`,
+		},
+	}
+
+	for _, tc := range tests {
+		if err := tc.change(); err != nil {
+			t.Errorf("%v returned error: %v", tc.name, err)
+		}
+
+		if got := strings.TrimSpace(requests[tc.key]); got != tc.wantReq {
+			t.Errorf("%v sent %q, want %q", tc.name, got, tc.wantReq)
+		}
+	}
+
+	if err := c.DeleteLab("/missing.unl"); err == nil {
+		t.Errorf("DeleteLab() of a missing lab returned no error")
+	}
+}
+
+func TestNodes(t *testing.T) {
+	c, _ := newTestClient(t)
+	if err := c.Login("admin", "eve"); err != nil {
+		t.Fatalf("Login() returned error: %v", err)
+	}
+
+	want := []Node{
+		{ID: 1, Name: "R1", Type: "qemu", Template: "vios", Image: "vios-15.6", CPU: 1, RAM: 1024, Ethernet: 4, Left: 35, Top: 25, Status: NodeStopped},
+		{ID: 2, Name: "R2", Type: "qemu", Template: "vios", Image: "vios-15.6", CPU: 1, RAM: 1024, Ethernet: 4, Left: 300, Top: 100, Status: NodeRunning},
+	}
+
+	got, err := c.Nodes("/team/ospf.unl")
+	if err != nil {
+		t.Fatalf("Nodes() returned error: %v", err)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Nodes() returned unexpected diff (-want +got):\n%s", diff)
+	}
+	got, err = c.Nodes("/team/empty.unl")
+	if err != nil {
+		t.Fatalf("Nodes() for an empty lab returned error: %v", err)
+	}
+
+	if diff := cmp.Diff([]Node{}, got); diff != "" {
+		t.Errorf("Nodes() for an empty lab returned unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestNodeChanges(t *testing.T) {
+	c, requests := newTestClient(t)
+	if err := c.Login("admin", "eve"); err != nil {
+		t.Fatalf("Login() returned error: %v", err)
+	}
+
+	id, err := c.AddNode("/team/ospf.unl", Node{Name: "R3", Template: "vios", RAM: 2048, Left: 400})
+	if err != nil {
+		t.Fatalf("AddNode() returned error: %v", err)
+	}
+
+	if id != 3 {
+		t.Errorf("AddNode() returned id %d, want 3", id)
+	}
+
+	wantReq := `{"config":"Unconfigured","delay":0,"left":400,"name":"R3","ram":2048,"template":"vios","type":"qemu"}`
+	if got := strings.TrimSpace(requests["POST /api/labs/team/ospf.unl/nodes"]); got != wantReq {
+		t.Errorf("AddNode() sent %q, want %q", got, wantReq)
+	}
+
+	for name, f := range map[string]func(string, int) error{
+		"StartNode":  c.StartNode,
+		"StopNode":   c.StopNode,
+		"WipeNode":   c.WipeNode,
+		"DeleteNode": c.DeleteNode,
+	} {
+		if err := f("/team/ospf.unl", 1); err != nil {
+			t.Errorf("%v() returned error: %v", name, err)
+		}
+
+		if err := f("/team/ospf.unl", 9); err == nil {
+			t.Errorf("%v() of a missing node returned no error", name)
+		}
+	}
+}
+
+func TestNetworks(t *testing.T) {
+	c, requests := newTestClient(t)
+	if err := c.Login("admin", "eve"); err != nil {
+		t.Fatalf("Login() returned error: %v", err)
+	}
+
+	want := []Network{{ID: 1, Name: "mgmt", Type: "pnet1", Left: 300, Top: 50, Visibility: 1}}
+
+	got, err := c.Networks("/team/ospf.unl")
+	if err != nil {
+		t.Fatalf("Networks() returned error: %v", err)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Networks() returned unexpected diff (-want +got):\n%s", diff)
+	}
+
+	got, err = c.Networks("/team/empty.unl")
+	if err != nil {
+		t.Fatalf("Networks() for an empty lab returned error: %v", err)
+	}
+
+	if diff := cmp.Diff([]Network{}, got); diff != "" {
+		t.Errorf("Networks() for an empty lab returned unexpected diff (-want +got):\n%s", diff)
+	}
+
+	id, err := c.AddNetwork("/team/ospf.unl", Network{Name: "R1:Gi0/0--R2:Gi0/0"})
+	if err != nil || id != 2 {
+		t.Errorf("AddNetwork() returned id %d, error: %v, want id 2", id, err)
+	}
+
+	wantReq := `{"count":1,"left":0,"name":"R1:Gi0/0--R2:Gi0/0","postfix":0,"top":0,"type":"bridge","visibility":0}`
+	if got := strings.TrimSpace(requests["POST /api/labs/team/ospf.unl/networks"]); got != wantReq {
+		t.Errorf("AddNetwork() sent %q, want %q", got, wantReq)
+	}
+
+	if err := c.DeleteNetwork("/team/ospf.unl", 1); err != nil {
+		t.Errorf("DeleteNetwork() returned error: %v", err)
+	}
+}
+
+func TestInterfaces(t *testing.T) {
+	c, requests := newTestClient(t)
+	if err := c.Login("admin", "eve"); err != nil {
+		t.Fatalf("Login() returned error: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		id   int
+		want []Interface
+	}{
+		{
+			name: "Passing interface list",
+			id:   1,
+			want: []Interface{{Index: 0, Name: "Gi0/0", NetworkID: 1}, {Index: 1, Name: "Gi0/1"}},
+		},
+		{
+			name: "Passing interfaces by index",
+			id:   2,
+			want: []Interface{{Index: 0, Name: "e0/0"}, {Index: 16, Name: "e1/0", NetworkID: 2}},
+		},
+	}
+
+	for _, tc := range tests {
+		got, err := c.Interfaces("/team/ospf.unl", tc.id)
+		if err != nil {
+			t.Fatalf("Interfaces() for %v returned error: %v", tc.name, err)
+		}
+
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("Interfaces() for %v returned unexpected diff (-want +got):\n%s", tc.name, diff)
+		}
+	}
+
+	if err := c.ConnectInterface("/team/ospf.unl", 1, 1, 0); err != nil {
+		t.Errorf("ConnectInterface() returned error: %v", err)
+	}
+
+	if got, want := strings.TrimSpace(requests["PUT /api/labs/team/ospf.unl/nodes/1/interfaces"]), `{"1":""}`; got != want {
+		t.Errorf("ConnectInterface() sent %q, want %q", got, want)
+	}
+
+	if err := c.UpdateNode("/team/ospf.unl", Node{ID: 1, RAM: 2048}); err != nil {
+		t.Errorf("UpdateNode() returned error: %v", err)
+	}
+}
+
+func TestConfigs(t *testing.T) {
+	c, requests := newTestClient(t)
+	if err := c.Login("admin", "eve"); err != nil {
+		t.Fatalf("Login() returned error: %v", err)
+	}
+
+	if err := c.ExportConfig("/team/ospf.unl", 1); err != nil {
+		t.Errorf("ExportConfig() returned error: %v", err)
+	}
+
+	if err := c.ExportConfig("/team/ospf.unl", 2); err == nil {
+		t.Errorf("ExportConfig() of a node without export returned no error")
+	}
+
+	if got, err := c.Config("/team/ospf.unl", 1); err != nil || got != "hostname R1\n" {
+		t.Errorf("Config() returned %q, error: %v", got, err)
+	}
+
+	if err := c.SetConfig("/team/ospf.unl", 1, "hostname R1\n"); err != nil {
+		t.Errorf("SetConfig() returned error: %v", err)
+	}
+
+	if got, want := strings.TrimSpace(requests["PUT /api/labs/team/ospf.unl/configs/1"]), `{"data":"hostname R1\n","id":"1"}`; got != want {
+		t.Errorf("SetConfig() sent %q, want %q", got, want)
+	}
+
+	if err := c.UseConfig("/team/ospf.unl", 1, true); err != nil {
+		t.Errorf("UseConfig() returned error: %v", err)
+	}
+
+	if got, want := strings.TrimSpace(requests["PUT /api/labs/team/ospf.unl/nodes/1"]), `{"config":"1","id":1}`; got != want {
+		t.Errorf("UseConfig() sent %q, want %q", got, want)
+	}
+}
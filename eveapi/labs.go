@@ -0,0 +1,115 @@
+package eveapi
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Folder is the content of a lab folder.
+type Folder struct {
+	Folders []FolderEntry `json:"folders"`
+	Labs    []LabEntry    `json:"labs"`
+}
+
+// FolderEntry is a sub folder, Path is absolute, e.g. /team/ospf.
+type FolderEntry struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// LabEntry is a lab file in a folder, Path is absolute, e.g. /team/ospf.unl.
+type LabEntry struct {
+	File  string `json:"file"`
+	Path  string `json:"path"`
+	MTime string `json:"mtime"`
+}
+
+// Lab is a lab.
+type Lab struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Filename    string `json:"filename"`
+	Author      string `json:"author"`
+	Description string `json:"description"`
+	Body        string `json:"body"`
+	Version     string `json:"version"`
+}
+
+// Folder returns the folders and labs in the folder at path, / being the root.
+func (c *Client) Folder(path string) (*Folder, error) {
+	f := &Folder{}
+	if err := c.do(http.MethodGet, "folders/"+escapePath(path), nil, f); err != nil {
+		return nil, err
+	}
+
+	// The root folder lists its parent as "..".
+	var folders []FolderEntry
+	for _, e := range f.Folders {
+		if e.Name != ".." {
+			folders = append(folders, e)
+		}
+	}
+	f.Folders = folders
+
+	return f, nil
+}
+
+// Lab returns the lab at path, e.g. /team/ospf.unl.
+func (c *Client) Lab(path string) (*Lab, error) {
+	l := &Lab{}
+	if err := c.do(http.MethodGet, "labs/"+escapePath(path), nil, l); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// CreateFolder creates the folder name in the parent folder.
+func (c *Client) CreateFolder(parent, name string) error {
+	in := map[string]string{"path": "/" + strings.Trim(parent, "/"), "name": name}
+
+	return c.do(http.MethodPost, "folders", in, nil)
+}
+
+// DeleteFolder deletes the folder at path, with its labs.
+func (c *Client) DeleteFolder(path string) error {
+	return c.do(http.MethodDelete, "folders/"+escapePath(path), nil, nil)
+}
+
+// MoveFolder moves or renames the folder at path to newPath.
+func (c *Client) MoveFolder(path, newPath string) error {
+	in := map[string]string{"path": "/" + strings.Trim(newPath, "/")}
+
+	return c.do(http.MethodPut, "folders/"+escapePath(path), in, nil)
+}
+
+// CreateLab creates the lab l in folder. Only the name, author, description,
+// body and version of l are used.
+func (c *Client) CreateLab(folder string, l Lab) error {
+	if l.Version == "" {
+		l.Version = "1"
+	}
+
+	in := map[string]string{
+		"path":        "/" + strings.Trim(folder, "/"),
+		"name":        l.Name,
+		"version":     l.Version,
+		"author":      l.Author,
+		"description": l.Description,
+		"body":        l.Body,
+	}
+
+	return c.do(http.MethodPost, "labs", in, nil)
+}
+
+// DeleteLab deletes the lab at path.
+func (c *Client) DeleteLab(path string) error {
+	return c.do(http.MethodDelete, "labs/"+escapePath(path), nil, nil)
+}
+
+// MoveLab moves the lab at path into folder.
+func (c *Client) MoveLab(path, folder string) error {
+	in := map[string]string{"path": "/" + strings.Trim(folder, "/")}
+
+	return c.do(http.MethodPut, "labs/"+escapePath(path)+"/move", in, nil)
+}
@@ -0,0 +1,154 @@
+package eveapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// Network is a network of a lab, nodes connect to through their interfaces.
+type Network struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	// Type is bridge, or pnet0 to pnet9 for the eve-ng clouds.
+	Type string `json:"type"`
+	Left int    `json:"left"`
+	Top  int    `json:"top"`
+	// Visibility 0 hides the network, as for point-to-point links.
+	Visibility int `json:"visibility"`
+}
+
+// UnmarshalJSON decodes a network, whose numbers are strings in some eve-ng versions.
+func (n *Network) UnmarshalJSON(b []byte) error {
+	type network Network
+
+	var v struct {
+		network
+		ID         number `json:"id"`
+		Left       number `json:"left"`
+		Top        number `json:"top"`
+		Visibility number `json:"visibility"`
+	}
+
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	*n = Network(v.network)
+	n.ID, n.Left, n.Top, n.Visibility = int(v.ID), int(v.Left), int(v.Top), int(v.Visibility)
+
+	return nil
+}
+
+// Interface is an ethernet interface of a node. NetworkID 0 means not connected.
+type Interface struct {
+	Index     int
+	Name      string
+	NetworkID int
+}
+
+func networksPath(lab string) string {
+	return "labs/" + escapePath(lab) + "/networks"
+}
+
+// Networks returns the networks of the lab, sorted by id.
+func (c *Client) Networks(lab string) ([]Network, error) {
+	m := map[string]Network{}
+	if err := c.do(http.MethodGet, networksPath(lab), nil, &m); err != nil {
+		return nil, err
+	}
+
+	networks := []Network{}
+	for _, n := range m {
+		networks = append(networks, n)
+	}
+
+	sort.Slice(networks, func(i, j int) bool { return networks[i].ID < networks[j].ID })
+
+	return networks, nil
+}
+
+// AddNetwork adds the network n to the lab, and returns its id.
+func (c *Client) AddNetwork(lab string, n Network) (int, error) {
+	if n.Type == "" {
+		n.Type = "bridge"
+	}
+
+	in := map[string]interface{}{
+		"name":       n.Name,
+		"type":       n.Type,
+		"left":       n.Left,
+		"top":        n.Top,
+		"visibility": n.Visibility,
+		"count":      1,
+		"postfix":    0,
+	}
+
+	var out struct {
+		ID number `json:"id"`
+	}
+	if err := c.do(http.MethodPost, networksPath(lab), in, &out); err != nil {
+		return 0, err
+	}
+
+	return int(out.ID), nil
+}
+
+// DeleteNetwork deletes the network id of the lab, disconnecting its nodes.
+func (c *Client) DeleteNetwork(lab string, id int) error {
+	return c.do(http.MethodDelete, networksPath(lab)+"/"+strconv.Itoa(id), nil, nil)
+}
+
+// Interfaces returns the ethernet interfaces of the node id of the lab, sorted by index.
+func (c *Client) Interfaces(lab string, id int) ([]Interface, error) {
+	var out struct {
+		Ethernet json.RawMessage `json:"ethernet"`
+	}
+	if err := c.do(http.MethodGet, nodePath(lab, id)+"/interfaces", nil, &out); err != nil {
+		return nil, err
+	}
+
+	type iface struct {
+		Name      string `json:"name"`
+		NetworkID number `json:"network_id"`
+	}
+
+	// eve-ng sends the interfaces as a list, or as an object keyed by index.
+	byIndex := map[string]iface{}
+	var list []iface
+	if err := json.Unmarshal(out.Ethernet, &list); err == nil {
+		for i, f := range list {
+			byIndex[strconv.Itoa(i)] = f
+		}
+	} else if err := json.Unmarshal(out.Ethernet, &byIndex); err != nil {
+		return nil, err
+	}
+
+	ifaces := []Interface{}
+	for k, f := range byIndex {
+		i, err := strconv.Atoi(k)
+		if err != nil {
+			return nil, err
+		}
+
+		ifaces = append(ifaces, Interface{Index: i, Name: f.Name, NetworkID: int(f.NetworkID)})
+	}
+
+	sort.Slice(ifaces, func(i, j int) bool { return ifaces[i].Index < ifaces[j].Index })
+
+	return ifaces, nil
+}
+
+// ConnectInterface connects the interface index of the node id to the
+// network networkID, 0 disconnects it.
+func (c *Client) ConnectInterface(lab string, id, index, networkID int) error {
+	network := ""
+	if networkID != 0 {
+		network = strconv.Itoa(networkID)
+	}
+
+	in := map[string]string{strconv.Itoa(index): network}
+
+	return c.do(http.MethodPut, nodePath(lab, id)+"/interfaces", in, nil)
+}
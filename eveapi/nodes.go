@@ -0,0 +1,178 @@
+package eveapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Node statuses.
+const (
+	NodeStopped = 0
+	NodeRunning = 2
+)
+
+// Node is a node of a lab.
+type Node struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	// Type is qemu, iol, dynamips or docker.
+	Type     string `json:"type"`
+	Template string `json:"template"`
+	Image    string `json:"image"`
+	Icon     string `json:"icon"`
+	Console  string `json:"console"`
+	CPU      int    `json:"cpu"`
+	RAM      int    `json:"ram"`
+	Ethernet int    `json:"ethernet"`
+	// Left and Top are the position of the node in the topology, in pixels.
+	Left   int    `json:"left"`
+	Top    int    `json:"top"`
+	Status int    `json:"status"`
+	URL    string `json:"url"`
+}
+
+// number is a json number, which eve-ng sends as a number or a string.
+type number int
+
+func (n *number) UnmarshalJSON(b []byte) error {
+	s := strings.TrimSuffix(strings.Trim(string(b), `"`), "%")
+	if s == "" || s == "null" {
+		*n = 0
+		return nil
+	}
+
+	i, err := strconv.Atoi(s)
+	*n = number(i)
+
+	return err
+}
+
+// UnmarshalJSON decodes a node, whose numbers are strings in some eve-ng versions.
+func (n *Node) UnmarshalJSON(b []byte) error {
+	type node Node
+
+	var v struct {
+		node
+		ID       number `json:"id"`
+		CPU      number `json:"cpu"`
+		RAM      number `json:"ram"`
+		Ethernet number `json:"ethernet"`
+		Left     number `json:"left"`
+		Top      number `json:"top"`
+		Status   number `json:"status"`
+	}
+
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	*n = Node(v.node)
+	n.ID, n.CPU, n.RAM, n.Ethernet = int(v.ID), int(v.CPU), int(v.RAM), int(v.Ethernet)
+	n.Left, n.Top, n.Status = int(v.Left), int(v.Top), int(v.Status)
+
+	return nil
+}
+
+func nodesPath(lab string) string {
+	return "labs/" + escapePath(lab) + "/nodes"
+}
+
+func nodePath(lab string, id int) string {
+	return nodesPath(lab) + "/" + strconv.Itoa(id)
+}
+
+// Nodes returns the nodes of the lab, sorted by id.
+func (c *Client) Nodes(lab string) ([]Node, error) {
+	m := map[string]Node{}
+	if err := c.do(http.MethodGet, nodesPath(lab), nil, &m); err != nil {
+		return nil, err
+	}
+
+	nodes := []Node{}
+	for _, n := range m {
+		nodes = append(nodes, n)
+	}
+
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+
+	return nodes, nil
+}
+
+// AddNode adds the node n to the lab, and returns its id. The zero fields of
+// n take the template defaults.
+func (c *Client) AddNode(lab string, n Node) (int, error) {
+	if n.Type == "" {
+		n.Type = "qemu"
+	}
+
+	in := map[string]interface{}{
+		"type":     n.Type,
+		"template": n.Template,
+		"config":   "Unconfigured",
+		"delay":    0,
+	}
+
+	for k, v := range map[string]string{"name": n.Name, "image": n.Image, "icon": n.Icon, "console": n.Console} {
+		if v != "" {
+			in[k] = v
+		}
+	}
+
+	for k, v := range map[string]int{"cpu": n.CPU, "ram": n.RAM, "ethernet": n.Ethernet, "left": n.Left, "top": n.Top} {
+		if v != 0 {
+			in[k] = v
+		}
+	}
+
+	var out struct {
+		ID number `json:"id"`
+	}
+	if err := c.do(http.MethodPost, nodesPath(lab), in, &out); err != nil {
+		return 0, err
+	}
+
+	return int(out.ID), nil
+}
+
+// StartNode starts the node id of the lab.
+func (c *Client) StartNode(lab string, id int) error {
+	return c.do(http.MethodGet, nodePath(lab, id)+"/start", nil, nil)
+}
+
+// StopNode stops the node id of the lab.
+func (c *Client) StopNode(lab string, id int) error {
+	return c.do(http.MethodGet, nodePath(lab, id)+"/stop", nil, nil)
+}
+
+// WipeNode resets the node id of the lab to its template disk and startup config.
+func (c *Client) WipeNode(lab string, id int) error {
+	return c.do(http.MethodGet, nodePath(lab, id)+"/wipe", nil, nil)
+}
+
+// DeleteNode deletes the node id of the lab.
+func (c *Client) DeleteNode(lab string, id int) error {
+	return c.do(http.MethodDelete, nodePath(lab, id), nil, nil)
+}
+
+// UpdateNode updates the name, image, icon, cpu, ram, ethernet and position
+// of the node n.ID of the lab. Its zero fields are not changed.
+func (c *Client) UpdateNode(lab string, n Node) error {
+	in := map[string]interface{}{"id": n.ID}
+
+	for k, v := range map[string]string{"name": n.Name, "image": n.Image, "icon": n.Icon, "console": n.Console} {
+		if v != "" {
+			in[k] = v
+		}
+	}
+
+	for k, v := range map[string]int{"cpu": n.CPU, "ram": n.RAM, "ethernet": n.Ethernet, "left": n.Left, "top": n.Top} {
+		if v != 0 {
+			in[k] = v
+		}
+	}
+
+	return c.do(http.MethodPut, nodePath(lab, n.ID), in, nil)
+}
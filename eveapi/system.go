@@ -0,0 +1,56 @@
+package eveapi
+
+import (
+	"net/http"
+	"sort"
+)
+
+// SystemStatus is the eve-ng host status.
+type SystemStatus struct {
+	Version     string  `json:"version"`
+	QEMUVersion string  `json:"qemu_version"`
+	CPU         float64 `json:"cpu"`
+	Disk        float64 `json:"disk"`
+	Mem         float64 `json:"mem"`
+	Swap        float64 `json:"swap"`
+	// IOL, Dynamips and QEMU are the numbers of running nodes of each kind.
+	IOL      int `json:"iol"`
+	Dynamips int `json:"dynamips"`
+	QEMU     int `json:"qemu"`
+	// License is the license state, only the pro edition reports it.
+	License string `json:"license"`
+}
+
+// Template is a node template, e.g. csr1000vng.
+type Template struct {
+	Name        string
+	Description string
+}
+
+// Status returns the eve-ng host status.
+func (c *Client) Status() (*SystemStatus, error) {
+	s := &SystemStatus{}
+	if err := c.do(http.MethodGet, "status", nil, s); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Templates returns the node templates, sorted by name. Templates whose
+// images are missing are described as such by eve-ng.
+func (c *Client) Templates() ([]Template, error) {
+	m := map[string]string{}
+	if err := c.do(http.MethodGet, "list/templates/", nil, &m); err != nil {
+		return nil, err
+	}
+
+	var templates []Template
+	for name, desc := range m {
+		templates = append(templates, Template{Name: name, Description: desc})
+	}
+
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+
+	return templates, nil
+}
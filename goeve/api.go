@@ -0,0 +1,77 @@
+package goeve
+
+import (
+	"fmt"
+
+	"github.com/amb1s1/go-eve/connect"
+	evecompute "github.com/amb1s1/go-eve/eve-compute"
+	"github.com/amb1s1/go-eve/eveapi"
+)
+
+// apiURL is the eve-ng api url, as seen from the compute instance.
+var apiURL = "http://127.0.0.1"
+
+// apiSession is an eve-ng api session on the compute instance.
+type apiSession struct {
+	*client
+	sc  connect.Functions
+	api *eveapi.Client
+}
+
+// close logs out of the eve-ng api.
+func (a *apiSession) close() {
+	a.api.Logout()
+}
+
+// newAPISession logs into the eve-ng api of the lab as admin, through ssh.
+func newAPISession(instanceName, configFile string) (*apiSession, error) {
+	c, err := new(instanceName, configFile, false)
+	if err != nil {
+		return nil, err
+	}
+
+	service, err := evecompute.New()
+	if err != nil {
+		return nil, err
+	}
+
+	sc, err := c.sshClient(service)
+	if err != nil {
+		return nil, err
+	}
+
+	api, err := c.loginAPI(sc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiSession{client: c, sc: sc, api: api}, nil
+}
+
+// loginAPI logs into the eve-ng api of the lab as admin, through sc.
+func (c *client) loginAPI(sc connect.Functions) (*eveapi.Client, error) {
+	api, err := eveapi.New(apiURL, httpClient(sc))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := api.Login("admin", c.adminPassword()); err != nil {
+		return nil, fmt.Errorf("could not log into the eve-ng api of %v, error: %v", c.InstanceName, err)
+	}
+
+	return api, nil
+}
+
+// adminPassword returns the eve-ng web admin password of the lab, from the
+// config or the lab state, or the eve-ng default one.
+func (c *client) adminPassword() string {
+	if c.EveSetup.AdminPassword != "" {
+		return c.EveSetup.AdminPassword
+	}
+
+	if st, err := c.loadState(); err == nil && st.AdminPassword != "" {
+		return st.AdminPassword
+	}
+
+	return "eve"
+}
@@ -0,0 +1,206 @@
+package goeve
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amb1s1/go-eve/eveapi"
+)
+
+// Node backup methods.
+const (
+	backupExport  = "export"
+	backupConsole = "console"
+	backupStartup = "startup"
+	backupSkipped = "skipped"
+)
+
+// nodeFileEscaper escapes the node names in their backup file names, which
+// nodeFileUnescaper reverses.
+var (
+	nodeFileEscaper   = strings.NewReplacer("%", "%25", "/", "%2F")
+	nodeFileUnescaper = strings.NewReplacer("%2F", "/", "%25", "%")
+)
+
+// NodeBackup reports the configuration backup of a node.
+type NodeBackup struct {
+	Name string
+	// Method is export, console, startup or skipped.
+	Method string
+	File   string `json:",omitempty"`
+	Error  string `json:",omitempty"`
+}
+
+// BackupResult reports the configuration backup of an eve-ng lab.
+type BackupResult struct {
+	Lab    string
+	Dir    string
+	Commit string `json:",omitempty"`
+	Nodes  []NodeBackup
+}
+
+// labDir returns the directory of the eve-ng lab backups, its path without .unl.
+func labDir(dir, lab string) string {
+	return filepath.Join(dir, filepath.FromSlash(strings.TrimSuffix(strings.TrimPrefix(lab, "/"), ".unl")))
+}
+
+// nodeFile returns the backup file of the node in the lab directory.
+func nodeFile(dir, node string) string {
+	return filepath.Join(dir, nodeFileEscaper.Replace(node)+".cfg")
+}
+
+// fileNode returns the node name of the backup file, as nodeFile names it.
+func fileNode(file string) string {
+	return nodeFileUnescaper.Replace(strings.TrimSuffix(filepath.Base(file), ".cfg"))
+}
+
+// backupNode returns the configuration of the node. The configuration of a
+// running node is exported by eve-ng when its template supports it, or else
+// read from its console. A node which is not running has no running
+// configuration, its startup configuration saved in the lab is used instead.
+func (a *apiSession) backupNode(lab string, n eveapi.Node) (string, string, error) {
+	if n.Status != eveapi.NodeRunning {
+		config, err := a.api.Config(lab, n.ID)
+		if err != nil {
+			return "", backupStartup, err
+		}
+
+		if strings.TrimSpace(config) == "" {
+			return "", backupSkipped, errors.New("not running, and no startup configuration")
+		}
+
+		return config, backupStartup, nil
+	}
+
+	if err := a.api.ExportConfig(lab, n.ID); err == nil {
+		if config, err := a.api.Config(lab, n.ID); err == nil && strings.TrimSpace(config) != "" {
+			return config, backupExport, nil
+		}
+	} else {
+		log.Printf("Could not export the configuration of node %v, reading its console, error: %v", n.Name, err)
+	}
+
+	addr, err := consolePort(n.URL)
+	if err != nil {
+		return "", backupConsole, err
+	}
+
+	// The console may sit at a login prompt, or not take the commands.
+	config, err := scrapeConsole(a.sc, addr, commandsFor(n.Template))
+	if err == nil && !isConfig(config) {
+		err = fmt.Errorf("no configuration read from the console, log in and leave it at a privileged prompt")
+	}
+
+	return config, backupConsole, err
+}
+
+// gitCommit commits all the changes of the git repository dir, creating it
+// if needed, and returns the commit, or "" when nothing changed.
+func gitCommit(dir, message string) (string, error) {
+	git := func(args ...string) (string, error) {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return "", fmt.Errorf("git %v failed, error: %v, output: %s", strings.Join(args, " "), err, out)
+		}
+
+		return strings.TrimSpace(string(out)), nil
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, ".git")); os.IsNotExist(err) {
+		if _, err := git("init"); err != nil {
+			return "", err
+		}
+	}
+
+	if _, err := git("add", "-A"); err != nil {
+		return "", err
+	}
+
+	if _, err := git("diff", "--cached", "--quiet"); err == nil {
+		return "", nil
+	}
+
+	// Commit as go-eve where git has no identity configured.
+	var identity []string
+	for k, v := range map[string]string{"user.name": "go-eve", "user.email": "go-eve@localhost"} {
+		if _, err := git("config", k); err != nil {
+			identity = append(identity, "-c", k+"="+v)
+		}
+	}
+
+	if _, err := git(append(identity, "commit", "-q", "-m", message)...); err != nil {
+		return "", err
+	}
+
+	return git("rev-parse", "--short", "HEAD")
+}
+
+// Backup saves the configuration of every node of the eve-ng lab in
+// dir/<lab path>/<node>.cfg, and commits it in the git repository dir. The
+// nodes which are not running are saved with their startup configuration.
+func Backup(instanceName, configFile, lab, dir string) (*BackupResult, error) {
+	a, err := newAPISession(instanceName, configFile)
+	if err != nil {
+		return nil, err
+	}
+	defer a.close()
+
+	lab = cleanPath(lab)
+
+	nodes, err := a.api.Nodes(lab)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &BackupResult{Lab: lab, Dir: dir, Nodes: make([]NodeBackup, len(nodes))}
+
+	ld := labDir(dir, lab)
+	if err := os.MkdirAll(ld, 0755); err != nil {
+		return nil, err
+	}
+
+	var wg sync.WaitGroup
+	for i, n := range nodes {
+		r.Nodes[i] = NodeBackup{Name: n.Name, Method: backupSkipped}
+
+		wg.Add(1)
+		go func(b *NodeBackup, n eveapi.Node) {
+			defer wg.Done()
+
+			config, method, err := a.backupNode(lab, n)
+			b.Method = method
+			if err != nil {
+				b.Error = err.Error()
+				return
+			}
+
+			b.File = nodeFile(ld, n.Name)
+			if err := ioutil.WriteFile(b.File, []byte(config), 0644); err != nil {
+				b.Error = err.Error()
+			}
+		}(&r.Nodes[i], n)
+	}
+	wg.Wait()
+
+	msg := fmt.Sprintf("Backup of %v on %v at %v", lab, a.InstanceName, time.Now().UTC().Format(time.RFC3339))
+	if r.Commit, err = gitCommit(dir, msg); err != nil {
+		return r, err
+	}
+
+	for _, b := range r.Nodes {
+		if b.Error != "" && b.Method != backupSkipped {
+			return r, fmt.Errorf("could not back up all the nodes")
+		}
+	}
+
+	return r, nil
+}
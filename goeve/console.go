@@ -0,0 +1,206 @@
+package goeve
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/amb1s1/go-eve/connect"
+)
+
+var (
+	// consoleIdle is how long the console must stay silent for a command to be done.
+	consoleIdle = 3 * time.Second
+	// consoleTimeout limits a console command.
+	consoleTimeout = 2 * time.Minute
+)
+
+// consoleCommands are the commands printing the configuration, by template
+// prefix. The last one prints it, the ones before prepare the console.
+var consoleCommands = map[string][]string{
+	"":      {"", "enable", "terminal length 0", "show running-config"},
+	"veos":  {"", "enable", "terminal length 0", "show running-config"},
+	"vmx":   {"", "cli", "show configuration | no-more"},
+	"vsrx":  {"", "cli", "show configuration | no-more"},
+	"vqfx":  {"", "cli", "show configuration | no-more"},
+	"xrv":   {"", "terminal length 0", "show running-config"},
+	"nxosv": {"", "terminal length 0", "show running-config"},
+	"vyos":  {"", "show configuration commands | cat"},
+}
+
+// commandsFor returns the console commands of the template, by its longest known prefix.
+func commandsFor(template string) []string {
+	best := ""
+	for prefix := range consoleCommands {
+		if strings.HasPrefix(template, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+
+	return consoleCommands[best]
+}
+
+// configMarkers are found in every configuration, and not in the error
+// messages or login prompts of a console which did not print it.
+var configMarkers = []string{"hostname", "host-name", "version"}
+
+// isConfig returns whether the console output s is a configuration.
+func isConfig(s string) bool {
+	if strings.Contains(s, "% Invalid input") || strings.Contains(s, "unknown command") {
+		return false
+	}
+
+	for _, m := range configMarkers {
+		if strings.Contains(s, m) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// consolePort returns the address of the node console, from its telnet url,
+// as seen from the compute instance.
+func consolePort(nodeURL string) (string, error) {
+	u, err := url.Parse(nodeURL)
+	if err != nil || u.Scheme != "telnet" || u.Port() == "" {
+		return "", fmt.Errorf("node console %q is not a telnet console", nodeURL)
+	}
+
+	return "127.0.0.1:" + u.Port(), nil
+}
+
+// scrapeConsole runs the commands on the node telnet console, and returns the
+// output of the last one.
+func scrapeConsole(sc connect.Functions, addr string, commands []string) (string, error) {
+	conn, err := sc.Dial("tcp", addr)
+	if err != nil {
+		return "", fmt.Errorf("could not connect to console %v, error: %v", addr, err)
+	}
+	defer conn.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	chunks := readChunks(conn.Read, done)
+
+	var out []byte
+	for _, cmd := range commands {
+		if _, err := conn.Write([]byte(cmd + "\r")); err != nil {
+			return "", err
+		}
+
+		if out, err = readUntilIdle(chunks, consoleIdle, consoleTimeout); err != nil {
+			return "", err
+		}
+	}
+
+	return cleanConsole(stripTelnet(out), commands[len(commands)-1]), nil
+}
+
+// chunk is the result of a read.
+type chunk struct {
+	b   []byte
+	err error
+}
+
+// readChunks reads with read until it fails or done is closed, sending what
+// it reads on the returned channel, which is closed after the failure.
+func readChunks(read func([]byte) (int, error), done <-chan struct{}) <-chan chunk {
+	chunks := make(chan chunk)
+
+	go func() {
+		defer close(chunks)
+
+		for {
+			b := make([]byte, 4096)
+			n, err := read(b)
+			select {
+			case chunks <- chunk{b[:n], err}:
+			case <-done:
+				return
+			}
+
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	return chunks
+}
+
+// readUntilIdle returns what was read until nothing was read for idle, the
+// reads failed, or for at most timeout.
+func readUntilIdle(chunks <-chan chunk, idle, timeout time.Duration) ([]byte, error) {
+	var out []byte
+	deadline := time.After(timeout)
+	for {
+		select {
+		case c, ok := <-chunks:
+			if !ok {
+				return out, nil
+			}
+
+			out = append(out, c.b...)
+		case <-time.After(idle):
+			return out, nil
+		case <-deadline:
+			return out, fmt.Errorf("console did not go idle within %v", timeout)
+		}
+	}
+}
+
+// stripTelnet removes the telnet negotiations from b.
+func stripTelnet(b []byte) []byte {
+	const (
+		iac = 255
+		sb  = 250
+		se  = 240
+	)
+
+	var out []byte
+	for i := 0; i < len(b); i++ {
+		if b[i] != iac || i+1 >= len(b) {
+			out = append(out, b[i])
+			continue
+		}
+
+		switch c := b[i+1]; {
+		case c == iac:
+			out = append(out, iac)
+			i++
+		case c == sb:
+			end := bytes.Index(b[i:], []byte{iac, se})
+			if end < 0 {
+				return out
+			}
+			i += end + 1
+		case c >= 251:
+			// WILL, WONT, DO and DONT take an option.
+			i += 2
+		default:
+			i++
+		}
+	}
+
+	return out
+}
+
+// cleanConsole returns the console output following the echo of the command,
+// without the final prompt line.
+func cleanConsole(b []byte, command string) string {
+	s := strings.ReplaceAll(string(b), "\r", "")
+
+	if i := strings.LastIndex(s, command+"\n"); i >= 0 {
+		s = s[i+len(command)+1:]
+	}
+
+	if i := strings.LastIndex(strings.TrimRight(s, "\n"), "\n"); i >= 0 {
+		s = s[:i+1]
+	}
+
+	return s
+}
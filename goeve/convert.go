@@ -0,0 +1,131 @@
+package goeve
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+
+	"github.com/amb1s1/go-eve/connect"
+)
+
+// qemuImg is the qemu-img eve-ng ships with.
+var qemuImg = "/opt/qemu/bin/qemu-img"
+
+// leakedClusters is printed by checkImage when qemu-img check only found
+// leaked clusters, which waste space but do not corrupt the image.
+const leakedClusters = "go-eve: leaked clusters"
+
+// checkImage runs qemu-img check on the qcow2 image. Its exit status 3, for
+// leaked clusters only, is a warning; 1 and 2 are errors.
+func checkImage(sc connect.Functions, image string) error {
+	cmd := fmt.Sprintf("%v check %v; s=$?; [ $s -ne 3 ] || echo %v; [ $s -eq 0 ] || [ $s -eq 3 ]", qemuImg, connect.ShellQuote(image), connect.ShellQuote(leakedClusters))
+
+	out, err := sc.Run(cmd)
+	if err != nil {
+		return fmt.Errorf("converted image %v failed the qemu-img check, error: %v, output: %s", image, err, out)
+	}
+
+	if strings.Contains(string(out), leakedClusters) {
+		log.Printf("Warning: converted image %v has leaked clusters, they only waste space: %s", image, out)
+	}
+
+	return nil
+}
+
+// ovaDisk returns the disk of the OVA from its tar listing. OVAs holding
+// several disks are refused, their disks are uploaded one by one.
+func ovaDisk(listing string) (string, error) {
+	var disks []string
+	for _, l := range strings.Split(listing, "\n") {
+		if l = strings.TrimSpace(l); strings.HasSuffix(strings.ToLower(l), ".vmdk") {
+			disks = append(disks, l)
+		}
+	}
+
+	switch len(disks) {
+	case 0:
+		return "", fmt.Errorf("OVA holds no vmdk disk")
+	case 1:
+		return disks[0], nil
+	}
+
+	return "", fmt.Errorf("OVA holds %v disks: %v, extract them and upload each with its disk", len(disks), strings.Join(disks, ", "))
+}
+
+// imageFormat returns the format of the remote disk file, as qemu-img detects it.
+func imageFormat(sc connect.Functions, file string) (string, error) {
+	out, err := sc.Run(qemuImg + " info --output=json " + connect.ShellQuote(file))
+	if err != nil {
+		return "", fmt.Errorf("could not detect the format of %v, error: %v, output: %s", file, err, out)
+	}
+
+	var info struct {
+		Format string `json:"format"`
+	}
+	if err := json.Unmarshal(out, &info); err != nil {
+		return "", fmt.Errorf("could not parse the qemu-img info of %v, error: %v", file, err)
+	}
+
+	return info.Format, nil
+}
+
+// convertImage converts the remote disk file src, OVAs extracted first, to the
+// qcow2 disk dst, checks it and removes src. It returns the format src was in.
+func convertImage(sc connect.Functions, src, dst string) (string, error) {
+	if strings.EqualFold(path.Ext(src), ".ova") {
+		out, err := sc.Run("tar -tf " + connect.ShellQuote(src))
+		if err != nil {
+			return "", fmt.Errorf("could not list the OVA %v, error: %v, output: %s", src, err, out)
+		}
+
+		disk, err := ovaDisk(string(out))
+		if err != nil {
+			return "", err
+		}
+
+		dir := path.Dir(src)
+		cmd := fmt.Sprintf("tar -xf %v -C %v %v && rm -f %v",
+			connect.ShellQuote(src), connect.ShellQuote(dir), connect.ShellQuote(disk), connect.ShellQuote(src))
+		if out, err := sc.Run(cmd); err != nil {
+			return "", fmt.Errorf("could not extract %v from the OVA %v, error: %v, output: %s", disk, src, err, out)
+		}
+
+		src = path.Join(dir, disk)
+	}
+
+	format, err := imageFormat(sc, src)
+	if err != nil {
+		return "", err
+	}
+
+	if format == "qcow2" {
+		if src == dst {
+			return format, nil
+		}
+
+		if out, err := sc.Run(fmt.Sprintf("mv -f %v %v", connect.ShellQuote(src), connect.ShellQuote(dst))); err != nil {
+			return "", fmt.Errorf("could not rename %v, error: %v, output: %s", src, err, out)
+		}
+
+		return format, nil
+	}
+
+	log.Printf("converting the %v image %v to qcow2.", format, src)
+
+	cmd := fmt.Sprintf("%v convert -f %v -O qcow2 %v %v", qemuImg, format, connect.ShellQuote(src), connect.ShellQuote(dst))
+	if out, err := sc.Run(cmd); err != nil {
+		return "", fmt.Errorf("could not convert %v to qcow2, error: %v, output: %s", src, err, out)
+	}
+
+	if err := checkImage(sc, dst); err != nil {
+		return "", err
+	}
+
+	if out, err := sc.Run("rm -f " + connect.ShellQuote(src)); err != nil {
+		return "", fmt.Errorf("could not remove %v, error: %v, output: %s", src, err, out)
+	}
+
+	return format, nil
+}
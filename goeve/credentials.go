@@ -0,0 +1,110 @@
+package goeve
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+)
+
+const (
+	// passwordLength is the length of the generated lab passwords.
+	passwordLength = 20
+	// passwordChars are the characters of the generated lab passwords, safe to
+	// embed in shell and json strings.
+	passwordChars = "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+// Credentials are the credentials of a lab.
+type Credentials struct {
+	Lab           string
+	RootPassword  string
+	AdminUser     string
+	AdminPassword string
+}
+
+func generatePassword() (string, error) {
+	b := make([]byte, passwordLength)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(passwordChars))))
+		if err != nil {
+			return "", err
+		}
+
+		b[i] = passwordChars[n.Int64()]
+	}
+
+	return string(b), nil
+}
+
+// loadCredentials sets the root and web admin passwords of the lab. Passwords
+// not set in the config come from the lab state, and are generated and saved
+// in the lab state the first time.
+func (c *client) loadCredentials() error {
+	st, err := c.loadState()
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	for _, p := range []struct {
+		config *string
+		state  *string
+	}{
+		{&c.EveSetup.RootPassword, &st.RootPassword},
+		{&c.EveSetup.AdminPassword, &st.AdminPassword},
+	} {
+		if *p.config != "" {
+			continue
+		}
+
+		if *p.state == "" {
+			if *p.state, err = generatePassword(); err != nil {
+				return err
+			}
+
+			changed = true
+		}
+
+		*p.config = *p.state
+	}
+
+	if changed {
+		return c.saveState(st)
+	}
+
+	return nil
+}
+
+// GetCredentials returns the root and web admin credentials of the lab.
+func GetCredentials(instanceName, configFile string) (*Credentials, error) {
+	c, err := new(instanceName, configFile, false)
+	if err != nil {
+		return nil, err
+	}
+
+	st, err := c.loadState()
+	if err != nil {
+		return nil, err
+	}
+
+	cr := &Credentials{
+		Lab:           c.InstanceName,
+		RootPassword:  c.EveSetup.RootPassword,
+		AdminUser:     "admin",
+		AdminPassword: c.EveSetup.AdminPassword,
+	}
+
+	if cr.RootPassword == "" {
+		cr.RootPassword = st.RootPassword
+	}
+
+	if cr.AdminPassword == "" {
+		cr.AdminPassword = st.AdminPassword
+	}
+
+	if cr.RootPassword == "" && cr.AdminPassword == "" {
+		return nil, errors.New("no credentials found for lab " + c.InstanceName + ", was it created by go-eve?")
+	}
+
+	return cr, nil
+}
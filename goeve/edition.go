@@ -0,0 +1,105 @@
+package goeve
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/amb1s1/go-eve/connect"
+)
+
+// Eve-ng editions.
+const (
+	editionCommunity = "community"
+	editionPro       = "pro"
+)
+
+var (
+	// defaultLicensePath is where the eve-ng professional license is installed.
+	defaultLicensePath = "/opt/unetlab/eve-ng.lic"
+
+	// proSteps install the eve-ng professional license, after the default steps.
+	proSteps = []step{
+		{Name: "upload eve-pro-license.sh", Type: stepUpload, Script: "eve-pro-license.sh"},
+		{Name: "run eve-pro-license.sh", Type: stepRun, Script: "eve-pro-license.sh"},
+	}
+)
+
+// loadLicense reads the local eve-ng professional license file, to render it
+// into eve-pro-license.sh. Only provisioning needs it.
+func (e *eveSetup) loadLicense() error {
+	if e.Edition != editionPro {
+		return nil
+	}
+
+	file, err := expandHome(e.LicenseFile)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("could not read the eve-ng pro license file %v, error: %v", e.LicenseFile, err)
+	}
+
+	e.License = base64.StdEncoding.EncodeToString(f)
+
+	return nil
+}
+
+// expandHome replaces the leading ~ of the path p with the user home directory.
+func expandHome(p string) (string, error) {
+	if p != "~" && !strings.HasPrefix(p, "~/") {
+		return p, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, p[1:]), nil
+}
+
+// activeLicenses are the license states eve-ng pro reports once activated.
+var activeLicenses = map[string]bool{"valid": true, "active": true, "activated": true, "ok": true}
+
+// editionStatus returns the eve-ng edition installed on the compute instance,
+// and the state of its license as eve-ng reports it: not needed for community,
+// and for pro missing, activated, not activated or unknown when eve-ng could
+// not tell.
+func (c *client) editionStatus(sc connect.Functions) (string, string) {
+	if _, err := sc.Run("dpkg-query -W -f='${Status}' eve-ng-pro | grep -q 'install ok installed'"); err != nil {
+		return editionCommunity, "not needed"
+	}
+
+	if _, err := sc.Run("sudo test -e " + connect.ShellQuote(c.EveSetup.LicensePath)); err != nil {
+		return editionPro, "missing"
+	}
+
+	api, err := c.loginAPI(sc)
+	if err != nil {
+		log.Printf("Could not ask eve-ng for its license state, error: %v", err)
+		return editionPro, "unknown"
+	}
+	defer api.Logout()
+
+	st, err := api.Status()
+	if err != nil {
+		log.Printf("Could not ask eve-ng for its license state, error: %v", err)
+		return editionPro, "unknown"
+	}
+
+	switch l := strings.ToLower(st.License); {
+	case activeLicenses[l]:
+		return editionPro, "activated"
+	case l == "":
+		return editionPro, "unknown"
+	default:
+		return editionPro, "not activated: " + st.License
+	}
+}
@@ -5,8 +5,9 @@ import (
 	"io/ioutil"
 	"log"
 	"net"
+	"os"
+	"path/filepath"
 	"strings"
-	"time"
 
 	"github.com/amb1s1/go-eve/connect"
 	"google.golang.org/protobuf/proto"
@@ -17,7 +18,6 @@ import (
 )
 
 var (
-	bashFiles    = []string{"install.sh", "eve-initial-setup.sh"}
 	configFile   = "config.yaml"
 	fwDirections = []string{"INGRESS", "EGRESS"}
 )
@@ -32,20 +32,36 @@ type Status struct {
 	Instance string
 	Settings string
 	Firewall firewalls
+	Edition  string            `json:",omitempty"`
+	License  string            `json:",omitempty"`
+	Checks   []Check           `json:",omitempty"`
+	Versions *connect.Versions `json:",omitempty"`
 }
 
 type client struct {
-	ProjectID         string `yaml:"projectID"`
-	InstanceName      string `yaml:"instanceName"`
-	Zone              string `yaml:"zone"`
-	PublicKeyPath     string `yaml:"publicKeyPath"`
-	PrivateKeyPath    string `yaml:"privateKeyPath"`
-	SSHKeyUsername    string `yaml:"sshKeyUsername"`
-	CustomImageName   string `yaml:"customImageName"`
-	MachineType       string `yaml:"machineType"`
-	DiskSize          int64  `yaml:"diskSize"`
+	ProjectID         string             `yaml:"projectID"`
+	InstanceName      string             `yaml:"instanceName"`
+	Zone              string             `yaml:"zone"`
+	PublicKeyPath     string             `yaml:"publicKeyPath"`
+	PrivateKeyPath    string             `yaml:"privateKeyPath"`
+	SSHKeyUsername    string             `yaml:"sshKeyUsername"`
+	CustomImageName   string             `yaml:"customImageName"`
+	MachineType       string             `yaml:"machineType"`
+	DiskSize          int64              `yaml:"diskSize"`
+	Scripts           map[string]string  `yaml:"scripts"`
+	TemplateScripts   bool               `yaml:"templateScripts"`
+	StateDir          string             `yaml:"stateDir"`
+	NoIngressFirewall bool               `yaml:"noIngressFirewall"`
+	Provisioning      []step             `yaml:"provisioning"`
+	ProvisioningMode  string             `yaml:"provisioningMode"`
+	EveSetup          eveSetup           `yaml:"eveSetup"`
+	NetworkInterfaces []networkInterface `yaml:"networkInterfaces"`
+	Hooks             map[string]hooks   `yaml:"hooks"`
 	createCustomImage bool
-	Status            *Status
+	// instanceCreated is set when go-eve just created the compute instance,
+	// whose new host key is then trusted.
+	instanceCreated bool
+	Status          *Status
 }
 
 func new(instanceName, orideConfigFile string, createCustomImage bool) (*client, error) {
@@ -68,6 +84,39 @@ func new(instanceName, orideConfigFile string, createCustomImage bool) (*client,
 		c.InstanceName = instanceName
 	}
 
+	if c.StateDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+
+		c.StateDir = filepath.Join(home, ".go-eve")
+	}
+
+	if err := validateSteps(c.Provisioning); err != nil {
+		return nil, err
+	}
+
+	if err := validateMode(c.ProvisioningMode); err != nil {
+		return nil, err
+	}
+
+	c.EveSetup.setDefaults()
+	c.EveSetup.secretsOnInstance = c.ProvisioningMode == modeStartupScript
+	if err := c.EveSetup.validate(); err != nil {
+		return nil, err
+	}
+
+	if err := validateNetworkInterfaces(c.NetworkInterfaces); err != nil {
+		return nil, err
+	}
+
+	if err := validateHooks(c.Hooks); err != nil {
+		return nil, err
+	}
+
+	c.EveSetup.CloudBridges = cloudBridges(c.NetworkInterfaces)
+
 	c.createCustomImage = createCustomImage
 
 	return c, nil
@@ -167,6 +216,39 @@ func (c *client) instanceRequest() *compute.Instance {
 			},
 		},
 	}
+
+	r.NetworkInterfaces = append(r.NetworkInterfaces, c.networkInterfaceRequests(prefix)...)
+
+	if c.ProvisioningMode == modeStartupScript {
+		script, err := c.startupScript()
+		if err != nil {
+			log.Fatalf("Could not generate the startup script, error: %v", err)
+		}
+
+		r.Metadata.Items = append(r.Metadata.Items,
+			&compute.MetadataItems{
+				Key:   "startup-script",
+				Value: proto.String(script),
+			},
+			&compute.MetadataItems{
+				Key:   "enable-guest-attributes",
+				Value: proto.String("TRUE"),
+			},
+		)
+
+		secrets, err := c.secretsMetadata()
+		if err != nil {
+			log.Fatalf("Could not generate the secrets metadata, error: %v", err)
+		}
+
+		if secrets != "" {
+			r.Metadata.Items = append(r.Metadata.Items, &compute.MetadataItems{
+				Key:   secretsMetadataKey,
+				Value: proto.String(secrets),
+			})
+		}
+	}
+
 	return r
 
 }
@@ -201,38 +283,63 @@ func (c *client) readSSHKey() []byte {
 func (c *client) initialSetup(publicKey, privateKey, username string, ip net.Addr) error {
 	log.Println("Initializing eve-go settings")
 
-	for _, f := range bashFiles {
-		sc, err := connect.NewClient(publicKey, privateKey, username, ip)
-		if err != nil {
-			return err
-		}
+	// An instance go-eve just (re)built has a new host key, any other must
+	// keep the pinned one.
+	sc, err := connect.NewClient(publicKey, privateKey, username, ip, connect.HostKeyCallback(c.knownHostsFile(), c.instanceCreated))
+	if err != nil {
+		return err
+	}
 
-		if err := sc.Fetch(f); err != nil {
-			return err
-		}
+	log.Printf("Provisioning steps: %v", describeSteps(c.steps()))
 
-		out, err := sc.RunScript(f)
-		if err != nil {
-			return err
-		}
+	sc, err = c.provision(sc)
+	switch {
+	case errors.Is(err, errAlreadyConfigured):
+		log.Println(strings.ToLower(err.Error()))
+		c.Status.Settings = "not modified"
+	case err != nil:
+		return err
+	default:
+		c.Status.Settings = "configured"
+	}
 
-		if string(out) == "VM is already configured\n" {
-			log.Println(strings.ToLower(string(out)))
-			c.Status.Settings = "not modified"
+	c.Status.Checks = verify(sc)
+	if !passed(c.Status.Checks) {
+		c.Status.Settings += ", verification failed"
+	}
 
-			return nil
-		}
-		time.Sleep(60 * time.Second)
-		if err := sc.Reboot(); err != nil {
-			return err
-		}
+	c.Status.Edition, c.Status.License = c.editionStatus(sc)
+	if c.Status.Edition != c.EveSetup.Edition {
+		c.Status.Settings += ", " + c.EveSetup.Edition + " edition not installed"
 	}
 
-	c.Status.Settings = "configured"
+	if err := c.versions(sc); err != nil {
+		log.Printf("Could not get the installed versions, error: %v", err)
+	}
 
 	return nil
 }
 
+// knownHostsFile is the file pinning the host keys of the compute instances.
+func (c *client) knownHostsFile() string {
+	return filepath.Join(c.StateDir, "known_hosts")
+}
+
+// sshClient opens a ssh connection to the running compute instance, verifying
+// its host key against the pinned one.
+func (c *client) sshClient(s evecompute.ServiceFunctions) (connect.Functions, error) {
+	if status := s.InstanceStatus(c.ProjectID, c.Zone, c.InstanceName); status != "RUNNING" {
+		return nil, errors.New("compute instance " + c.InstanceName + " is not running")
+	}
+
+	ip, err := s.LookupExternalIP(c.ProjectID, c.Zone, c.InstanceName)
+	if err != nil {
+		return nil, err
+	}
+
+	return connect.NewClient(c.PublicKeyPath, c.PrivateKeyPath, c.SSHKeyUsername, ip, connect.HostKeyCallback(c.knownHostsFile(), false))
+}
+
 func (c *client) createImage(s evecompute.ServiceFunctions) error {
 	r := c.imageRequest()
 
@@ -252,15 +359,26 @@ func (c *client) createImage(s evecompute.ServiceFunctions) error {
 func (c *client) createInstance(s evecompute.ServiceFunctions) error {
 	r := c.instanceRequest()
 
+	created := s.InstanceStatus(c.ProjectID, c.Zone, c.InstanceName) == ""
+
 	if err := s.CreateInstance(c.ProjectID, c.Zone, r); err != nil {
 		return err
 	}
 
+	c.instanceCreated = created
+
 	return nil
 }
 
 func (c *client) createFirewallRules(s evecompute.ServiceFunctions) error {
 	for _, f := range fwDirections {
+		if f == "INGRESS" && c.NoIngressFirewall {
+			log.Println("Skipping the ingress firewall rule, reach the lab through goeve tunnel")
+			c.Status.Firewall.Ingress = "disabled"
+
+			continue
+		}
+
 		fr := c.firewallRequest(f)
 
 		if err := s.InsertFirewallRule(c.ProjectID, fr); err != nil {
@@ -314,6 +432,10 @@ func (c *client) teardown(s evecompute.ServiceFunctions) error {
 		return err
 	}
 
+	if err := c.removeState(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -332,6 +454,14 @@ func (c *client) resetInstance(s evecompute.ServiceFunctions) error {
 func (c *client) create(s evecompute.ServiceFunctions) error {
 	log.Println("Create, start the workflow for creating a new compute instance")
 
+	if err := c.loadCredentials(); err != nil {
+		return err
+	}
+
+	if err := c.EveSetup.loadLicense(); err != nil {
+		return err
+	}
+
 	if c.createCustomImage {
 		if err := c.createImage(s); err != nil {
 			return err
@@ -361,6 +491,10 @@ func (c *client) create(s evecompute.ServiceFunctions) error {
 		}
 	}
 
+	if c.ProvisioningMode == modeStartupScript {
+		return c.waitForStartupScript(s)
+	}
+
 	if err := c.setupInstance(s); err != nil {
 		return err
 	}
@@ -409,19 +543,19 @@ func Run(instanceName, configFile string, createCustomImage, createLab, resetIns
 
 	switch {
 	case stop:
-		if err := c.stop(status, service); err != nil {
+		if err := c.withHooks(actionStop, service, func() error { return c.stop(status, service) }); err != nil {
 			log.Fatalf("Could not stop compute instance %v, error: %v", c.InstanceName, err)
 		}
 	case resetInstance:
-		if err := c.resetInstance(service); err != nil {
+		if err := c.withHooks(actionReset, service, func() error { return c.resetInstance(service) }); err != nil {
 			log.Fatalf("Could not reset instance %v, error: %v", c.InstanceName, err)
 		}
 	case teardown:
-		if err := c.teardown(service); err != nil {
+		if err := c.withHooks(actionTeardown, service, func() error { return c.teardown(service) }); err != nil {
 			log.Fatalf("Could not teardown lab for compute instance %v, error: %v", c.InstanceName, err)
 		}
 	case createLab:
-		if err := c.create(service); err != nil {
+		if err := c.withHooks(actionCreate, service, func() error { return c.create(service) }); err != nil {
 			log.Fatalf("Could not create an entire lab, error: %v", err)
 		}
 	}
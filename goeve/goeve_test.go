@@ -1,11 +1,31 @@
 package goeve
 
 import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/amb1s1/go-eve/connect"
+	evecompute "github.com/amb1s1/go-eve/eve-compute"
+	"github.com/amb1s1/go-eve/eveapi"
 	"github.com/google/go-cmp/cmp"
+	"golang.org/x/crypto/ssh"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/testing/protocmp"
+	"gopkg.in/yaml.v2"
 
 	compute "google.golang.org/api/compute/v1"
 )
@@ -184,3 +204,2011 @@ func TestImageRequest(t *testing.T) {
 		}
 	}
 }
+
+func TestParsePortRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		r         string
+		wantFirst int
+		wantLast  int
+		wantErr   bool
+	}{
+		{
+			name:      "Passing range",
+			r:         "32769-32868",
+			wantFirst: 32769,
+			wantLast:  32868,
+		},
+		{
+			name:      "Passing single port",
+			r:         "32769",
+			wantFirst: 32769,
+			wantLast:  32769,
+		},
+		{
+			name:    "Failing reversed range",
+			r:       "32868-32769",
+			wantErr: true,
+		},
+		{
+			name:    "Failing not a port",
+			r:       "telnet",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		first, last, err := parsePortRange(tc.r)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("parsePortRange(%s) returned error: %v, want error: %v", tc.r, err, tc.wantErr)
+		}
+
+		if first != tc.wantFirst || last != tc.wantLast {
+			t.Errorf("parsePortRange(%s) = %d, %d, want %d, %d", tc.r, first, last, tc.wantFirst, tc.wantLast)
+		}
+	}
+}
+
+func TestProvisioningConfig(t *testing.T) {
+	config := `
+provisioning:
+- name: upload install.sh
+  type: upload
+  script: install.sh
+- name: wait for the eve-ng web ui
+  type: waitForPort
+  port: 80
+  timeout: 5m
+  retries: 2
+  retryDelay: 30s
+`
+	want := []step{
+		{Name: "upload install.sh", Type: stepUpload, Script: "install.sh"},
+		{Name: "wait for the eve-ng web ui", Type: stepWaitForPort, Port: 80, Timeout: 5 * time.Minute, Retries: 2, RetryDelay: 30 * time.Second},
+	}
+
+	c := &client{}
+	if err := yaml.Unmarshal([]byte(config), c); err != nil {
+		t.Fatalf("could not unmarshal the provisioning config, error: %v", err)
+	}
+
+	if diff := cmp.Diff(want, c.Provisioning); diff != "" {
+		t.Errorf("yaml.Unmarshal() returned unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestValidateSteps(t *testing.T) {
+	tests := []struct {
+		name    string
+		steps   []step
+		wantErr bool
+	}{
+		{
+			name:  "Passing default steps",
+			steps: defaultSteps,
+		},
+		{
+			name:    "Failing unknown type",
+			steps:   []step{{Name: "format disk", Type: "format"}},
+			wantErr: true,
+		},
+		{
+			name:    "Failing run step without script",
+			steps:   []step{{Name: "run", Type: stepRun}},
+			wantErr: true,
+		},
+		{
+			name:    "Failing waitForPort step without port",
+			steps:   []step{{Name: "wait", Type: stepWaitForPort}},
+			wantErr: true,
+		},
+		{
+			name:    "Failing step without name",
+			steps:   []step{{Type: stepReboot}},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		if err := validateSteps(tc.steps); (err != nil) != tc.wantErr {
+			t.Errorf("validateSteps() for %v returned error: %v, want error: %v", tc.name, err, tc.wantErr)
+		}
+	}
+}
+
+func TestFirstIncomplete(t *testing.T) {
+	want := []string{"upload\t\tabc", "run\t\tabc", "reboot\t\t"}
+
+	tests := []struct {
+		name string
+		done []string
+		want int
+	}{
+		{
+			name: "Nothing done",
+			want: 0,
+		},
+		{
+			name: "Resume after the upload",
+			done: []string{"upload\t\tabc"},
+			want: 1,
+		},
+		{
+			name: "Script changed",
+			done: []string{"upload\t\tdef", "run\t\tdef", "reboot\t\t"},
+			want: 0,
+		},
+		{
+			name: "Everything done",
+			done: []string{"upload\t\tabc", "run\t\tabc", "reboot\t\t"},
+			want: 3,
+		},
+	}
+
+	for _, tc := range tests {
+		if got := firstIncomplete(want, tc.done); got != tc.want {
+			t.Errorf("firstIncomplete() for %v = %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestStartupScript(t *testing.T) {
+	c, err := setup(t)
+	if err != nil {
+		t.Fatalf("could not create a new goeve client, error: %v", err)
+	}
+
+	c.EveSetup.RootPassword, c.EveSetup.AdminPassword = "root-secret", "admin-secret"
+	c.EveSetup.secretsOnInstance = true
+
+	script, err := c.startupScript()
+	if err != nil {
+		t.Fatalf("startupScript() returned error: %v", err)
+	}
+
+	for _, st := range defaultSteps {
+		if !strings.Contains(script, "report step '"+st.Name+"'") {
+			t.Errorf("startupScript() does not run step %q", st.Name)
+		}
+	}
+
+	// The scripts are base64 encoded in the startup script.
+	for _, name := range []string{"eve-initial-setup.sh", "eve-admin-password.sh"} {
+		got, err := c.script(name)
+		if err != nil {
+			t.Fatalf("script(%v) returned error: %v", name, err)
+		}
+
+		if strings.Contains(string(got), "-secret") || !strings.Contains(string(got), `"$(cat /opt/go-eve/secrets/`) {
+			t.Errorf("script(%v) does not read its secrets from the compute instance:\n%s", name, got)
+		}
+	}
+
+	if strings.Contains(script, "root-secret") || strings.Contains(script, "admin-secret") || !strings.Contains(script, "fetch_secrets || fail") {
+		t.Errorf("startupScript() does not fetch the secrets from the metadata")
+	}
+
+	secrets, err := c.secretsMetadata()
+	if err != nil {
+		t.Fatalf("secretsMetadata() returned error: %v", err)
+	}
+
+	if !strings.Contains(secrets, "root_password "+base64.StdEncoding.EncodeToString([]byte("root-secret"))+"\n") {
+		t.Errorf("secretsMetadata() returned %q, want the root password", secrets)
+	}
+
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not found, skipping the syntax check")
+	}
+
+	cmd := exec.Command(bash, "-n")
+	cmd.Stdin = strings.NewReader(script)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("startupScript() returned an invalid script, error: %v, output: %s", err, out)
+	}
+
+	// Scripts without secrets provision without them.
+	c.Provisioning = []step{{Name: "upload install.sh", Type: stepUpload, Script: "install.sh"}}
+
+	script, err = c.startupScript()
+	if err != nil {
+		t.Fatalf("startupScript() returned error: %v", err)
+	}
+
+	if strings.Contains(script, "fetch_secrets ||") {
+		t.Errorf("startupScript() fetches secrets no script needs")
+	}
+
+	if secrets, err := c.secretsMetadata(); secrets != "" || err != nil {
+		t.Errorf("secretsMetadata() returned %q, error: %v, want no secrets", secrets, err)
+	}
+}
+
+func TestRenderEveInitialSetup(t *testing.T) {
+	c, err := setup(t)
+	if err != nil {
+		t.Fatalf("could not create a new goeve client, error: %v", err)
+	}
+
+	c.EveSetup = eveSetup{
+		Hostname:     "lab1",
+		RootPassword: "eve-pwd",
+		Domain:       "corp.example.com",
+		NTP:          []string{"ntp1.corp.example.com", "ntp2.corp.example.com"},
+		Proxy:        proxy{Type: "anonymous", URL: "proxy.corp.example.com:3128"},
+	}
+	c.EveSetup.setDefaults()
+
+	got, err := c.script("eve-initial-setup.sh")
+	if err != nil {
+		t.Fatalf("script(eve-initial-setup.sh) returned error: %v", err)
+	}
+
+	for _, want := range []string{
+		"ovf_root_password='eve-pwd'",
+		"ovf_hostname='lab1'",
+		"ovf_domain='corp.example.com'",
+		"ovf_dhcp='dhcp'",
+		"ovf_ntp='ntp1.corp.example.com ntp2.corp.example.com'",
+		"ovf_proxy_type='anonymous proxy'",
+		"ovf_proxy_url='proxy.corp.example.com:3128'",
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("script(eve-initial-setup.sh) does not contain %q", want)
+		}
+	}
+}
+
+func TestRenderInstallPinnedVersion(t *testing.T) {
+	c, err := setup(t)
+	if err != nil {
+		t.Fatalf("could not create a new goeve client, error: %v", err)
+	}
+
+	c.EveSetup = eveSetup{Edition: "pro", EveVersion: "5.0.1-19"}
+	c.EveSetup.setDefaults()
+
+	got, err := c.script("install.sh")
+	if err != nil {
+		t.Fatalf("script(install.sh) returned error: %v", err)
+	}
+
+	for _, want := range []string{
+		"install-eve-pro.sh",
+		"apt-get install -y --allow-downgrades eve-ng-pro='5.0.1-19'",
+		"apt-mark hold eve-ng-pro",
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("script(install.sh) does not contain %q", want)
+		}
+	}
+}
+
+func TestEveSetupValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   eveSetup
+		wantErr bool
+	}{
+		{
+			name:  "Passing static network",
+			setup: eveSetup{Network: "static", IP: "10.0.0.2", Netmask: "255.255.255.0", Gateway: "10.0.0.1"},
+		},
+		{
+			name:    "Failing static network without ip",
+			setup:   eveSetup{Network: "static"},
+			wantErr: true,
+		},
+		{
+			name:    "Failing proxy without url",
+			setup:   eveSetup{Proxy: proxy{Type: "anonymous"}},
+			wantErr: true,
+		},
+		{
+			name:    "Failing unknown network",
+			setup:   eveSetup{Network: "bootp"},
+			wantErr: true,
+		},
+		{
+			name:  "Passing pro edition with a license file",
+			setup: eveSetup{Edition: "pro", LicenseFile: "eve-ng.lic"},
+		},
+		{
+			name:    "Failing pro edition without license file",
+			setup:   eveSetup{Edition: "pro"},
+			wantErr: true,
+		},
+		{
+			name:    "Failing unknown edition",
+			setup:   eveSetup{Edition: "enterprise"},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		tc.setup.setDefaults()
+		if err := tc.setup.validate(); (err != nil) != tc.wantErr {
+			t.Errorf("validate() for %v returned error: %v, want error: %v", tc.name, err, tc.wantErr)
+		}
+	}
+}
+
+func TestLoadCredentials(t *testing.T) {
+	c, err := setup(t)
+	if err != nil {
+		t.Fatalf("could not create a new goeve client, error: %v", err)
+	}
+	c.StateDir = t.TempDir()
+
+	if err := c.loadCredentials(); err != nil {
+		t.Fatalf("loadCredentials() returned error: %v", err)
+	}
+
+	root, admin := c.EveSetup.RootPassword, c.EveSetup.AdminPassword
+	if len(root) != passwordLength || len(admin) != passwordLength || root == admin {
+		t.Errorf("loadCredentials() generated root password %q and admin password %q", root, admin)
+	}
+
+	info, err := os.Stat(c.stateFile())
+	if err != nil {
+		t.Fatalf("loadCredentials() did not save the lab state, error: %v", err)
+	}
+
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("loadCredentials() saved the lab state with permissions %v, want 0600", perm)
+	}
+
+	c.EveSetup = eveSetup{}
+	if err := c.loadCredentials(); err != nil {
+		t.Fatalf("loadCredentials() returned error: %v", err)
+	}
+
+	if c.EveSetup.RootPassword != root || c.EveSetup.AdminPassword != admin {
+		t.Errorf("loadCredentials() did not reuse the saved passwords")
+	}
+}
+
+// fakeSSH is a connect.Functions answering Run with canned outputs and
+// dialing the given addresses instead of the compute instance ones. The
+// provisioning operations, and the commands run besides the marker reads and
+// writes, are recorded in calls. An operation fails when failing names it,
+// e.g. "run install.sh".
+type fakeSSH struct {
+	connect.Functions
+	failing map[string]bool
+	outputs map[string]string
+	addrs   map[string]string
+	calls   *[]string
+	// files are the remote files Pull copies, by path.
+	files map[string]string
+	// markers, when set, is the content of the marker file, "" when missing.
+	markers *string
+}
+
+func (f fakeSSH) call(op string) error {
+	if f.calls != nil {
+		*f.calls = append(*f.calls, op)
+	}
+
+	if f.failing[op] {
+		return fmt.Errorf("%v failed", op)
+	}
+
+	return nil
+}
+
+func (f fakeSSH) UploadContext(ctx context.Context, file string, content []byte) error {
+	return f.call("upload " + file)
+}
+
+func (f fakeSSH) RunScript(file string, timeout time.Duration) ([]byte, error) {
+	return nil, f.call("run " + file)
+}
+
+func (f fakeSSH) RebootAndWait(timeout time.Duration) (connect.Functions, error) {
+	// A failing reboot never comes back, as connect reports it.
+	if err := f.call("reboot"); err != nil {
+		return nil, fmt.Errorf("192.0.2.1 did not come back within %v", timeout)
+	}
+
+	return f, nil
+}
+
+func (f fakeSSH) RunContext(ctx context.Context, cmd string) ([]byte, error) {
+	return f.Run(cmd)
+}
+
+func (f fakeSSH) PinHostKeys(knownHosts string) error {
+	return f.call("pin host keys")
+}
+
+func (f fakeSSH) Pull(remote, local string, sudo bool) (*connect.SyncResult, error) {
+	content, ok := f.files[remote]
+	if !ok {
+		return nil, fmt.Errorf("no files found at %v", remote)
+	}
+
+	dst := connect.LocalDest(local, remote)
+	if err := ioutil.WriteFile(dst, []byte(content), 0644); err != nil {
+		return nil, err
+	}
+
+	return &connect.SyncResult{Transferred: []string{dst}, Bytes: int64(len(content))}, nil
+}
+
+func (f fakeSSH) Run(cmd string) ([]byte, error) {
+	if f.calls != nil && !strings.Contains(cmd, markerFile) {
+		*f.calls = append(*f.calls, cmd)
+	}
+
+	if f.markers != nil && strings.HasPrefix(cmd, "sudo cat "+markerFile) {
+		if *f.markers == "" {
+			return []byte("missing\n"), nil
+		}
+
+		return []byte(*f.markers), nil
+	}
+
+	if f.markers != nil && strings.HasSuffix(cmd, "| sudo tee "+markerFile+" > /dev/null") {
+		content := cmd[strings.Index(cmd, "printf %s '")+len("printf %s '") : strings.LastIndex(cmd, "' | sudo tee")]
+		*f.markers = content
+
+		return nil, nil
+	}
+
+	if f.failing[cmd] {
+		return []byte("inactive\n"), errors.New("exit status 3")
+	}
+
+	for prefix, out := range f.outputs {
+		if strings.HasPrefix(cmd, prefix) {
+			return []byte(out), nil
+		}
+	}
+
+	return []byte("active\n"), nil
+}
+
+func (f fakeSSH) Dial(network, addr string) (net.Conn, error) {
+	return net.Dial(network, f.addrs[addr])
+}
+
+func TestVerify(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	httpServer := httptest.NewServer(ok)
+	defer httpServer.Close()
+	httpsServer := httptest.NewTLSServer(ok)
+	defer httpsServer.Close()
+
+	sc := fakeSSH{
+		failing: map[string]bool{"systemctl is-active mysql": true},
+		addrs: map[string]string{
+			"127.0.0.1:80":  httpServer.Listener.Addr().String(),
+			"127.0.0.1:443": httpsServer.Listener.Addr().String(),
+		},
+	}
+
+	want := []Check{
+		{Name: "web ui http://127.0.0.1/", Passed: true, Detail: "200 OK"},
+		{Name: "web ui https://127.0.0.1/", Passed: true, Detail: "200 OK"},
+		{Name: "service apache2", Passed: true, Detail: "active"},
+		{Name: "service mysql", Detail: "inactive"},
+		{Name: "service unetlab", Passed: true, Detail: "active"},
+		{Name: "/dev/kvm", Passed: true},
+		{Name: "kvm-ok", Passed: true, Detail: "active"},
+	}
+
+	got := verify(sc)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("verify() returned unexpected diff (-want +got):\n%s", diff)
+	}
+
+	if passed(got) {
+		t.Errorf("passed() = true with a failed check")
+	}
+}
+
+func TestVersions(t *testing.T) {
+	tests := []struct {
+		name         string
+		eveVersion   string
+		wantSettings string
+	}{
+		{
+			name:         "Passing without pin",
+			wantSettings: "configured",
+		},
+		{
+			name:         "Passing pinned version installed",
+			eveVersion:   "2.0.3-112",
+			wantSettings: "configured",
+		},
+		{
+			name:         "Passing other version than the pinned one",
+			eveVersion:   "2.0.3-110",
+			wantSettings: "configured, eve-ng 2.0.3-112 installed instead of the pinned eve-ng 2.0.3-110",
+		},
+	}
+
+	sc := fakeSSH{
+		outputs: map[string]string{
+			"dpkg-query":  "eve-ng 2.0.3-112\n",
+			"uname":       "5.4.0-88-generic\n",
+			"(/opt/qemu":  "QEMU emulator version 4.1.0\n",
+			"lsb_release": "Ubuntu 20.04.3 LTS\n",
+		},
+	}
+
+	want := &connect.Versions{
+		EveNG:  "eve-ng 2.0.3-112",
+		Kernel: "5.4.0-88-generic",
+		QEMU:   "QEMU emulator version 4.1.0",
+		Ubuntu: "Ubuntu 20.04.3 LTS",
+	}
+
+	for _, tc := range tests {
+		c, err := setup(t)
+		if err != nil {
+			t.Fatalf("could not create a new goeve client, error: %v", err)
+		}
+		c.EveSetup.EveVersion = tc.eveVersion
+		c.Status = &Status{Settings: "configured"}
+
+		if err := c.versions(sc); err != nil {
+			t.Fatalf("versions() for %v returned error: %v", tc.name, err)
+		}
+
+		if diff := cmp.Diff(want, c.Status.Versions); diff != "" {
+			t.Errorf("versions() for %v returned unexpected diff (-want +got):\n%s", tc.name, diff)
+		}
+
+		if c.Status.Settings != tc.wantSettings {
+			t.Errorf("versions() for %v set settings %q, want %q", tc.name, c.Status.Settings, tc.wantSettings)
+		}
+	}
+}
+
+func TestCloudBridges(t *testing.T) {
+	nics := []networkInterface{
+		{Network: "lab-vpc", Pnet: 3},
+		{Network: "onprem-vpc", Pnet: 1},
+	}
+
+	want := map[int]string{1: "eth2", 2: "none", 3: "eth1", 4: "eth4", 9: "eth9"}
+
+	got := cloudBridges(nics)
+	if len(got) != maxPnet {
+		t.Fatalf("cloudBridges() returned %d bridges, want %d", len(got), maxPnet)
+	}
+
+	for _, b := range got {
+		if port, ok := want[b.Pnet]; ok && port != b.Port {
+			t.Errorf("cloudBridges() bridged pnet%d to %v, want %v", b.Pnet, b.Port, port)
+		}
+	}
+}
+
+func TestNetworkInterfaceRequests(t *testing.T) {
+	c, err := setup(t)
+	if err != nil {
+		t.Fatalf("could not create a new goeve client, error: %v", err)
+	}
+
+	c.NetworkInterfaces = []networkInterface{
+		{Network: "lab-vpc", Subnet: "lab-subnet", ExternalIP: true, Pnet: 1},
+	}
+
+	want := []*compute.NetworkInterface{
+		{
+			Network:    "https://www.googleapis.com/compute/v1/projects/testProject/global/networks/lab-vpc",
+			Subnetwork: "https://www.googleapis.com/compute/v1/projects/testProject/regions/us-central1/subnetworks/lab-subnet",
+			AccessConfigs: []*compute.AccessConfig{
+				{
+					Type: "ONE_TO_ONE_NAT",
+					Name: "External NAT",
+				},
+			},
+		},
+	}
+
+	got := c.networkInterfaceRequests("https://www.googleapis.com/compute/v1/projects/testProject")
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("networkInterfaceRequests() returned unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestValidateNetworkInterfaces(t *testing.T) {
+	tests := []struct {
+		name    string
+		nics    []networkInterface
+		wantErr bool
+	}{
+		{
+			name: "Passing two networks",
+			nics: []networkInterface{{Network: "a", Pnet: 1}, {Network: "b", Pnet: 2}},
+		},
+		{
+			name:    "Failing same pnet",
+			nics:    []networkInterface{{Network: "a", Pnet: 1}, {Network: "b", Pnet: 1}},
+			wantErr: true,
+		},
+		{
+			name:    "Failing same network",
+			nics:    []networkInterface{{Network: "a", Pnet: 1}, {Network: "a", Pnet: 2}},
+			wantErr: true,
+		},
+		{
+			name:    "Failing pnet0",
+			nics:    []networkInterface{{Network: "a", Pnet: 0}},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		if err := validateNetworkInterfaces(tc.nics); (err != nil) != tc.wantErr {
+			t.Errorf("validateNetworkInterfaces() for %v returned error: %v, want error: %v", tc.name, err, tc.wantErr)
+		}
+	}
+}
+
+func TestValidateHooks(t *testing.T) {
+	tests := []struct {
+		name    string
+		hooks   map[string]hooks
+		wantErr bool
+	}{
+		{
+			name: "Passing command and script hooks",
+			hooks: map[string]hooks{
+				"create": {Pre: []hook{{Command: "true"}}, Post: []hook{{Script: "templates.sh"}}},
+			},
+		},
+		{
+			name:    "Failing unknown action",
+			hooks:   map[string]hooks{"start": {Pre: []hook{{Command: "true"}}}},
+			wantErr: true,
+		},
+		{
+			name:    "Failing hook with a command and a script",
+			hooks:   map[string]hooks{"stop": {Pre: []hook{{Command: "true", Script: "templates.sh"}}}},
+			wantErr: true,
+		},
+		{
+			name:    "Failing script after teardown",
+			hooks:   map[string]hooks{"teardown": {Post: []hook{{Script: "templates.sh"}}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		if err := validateHooks(tc.hooks); (err != nil) != tc.wantErr {
+			t.Errorf("validateHooks() for %v returned error: %v, want error: %v", tc.name, err, tc.wantErr)
+		}
+	}
+}
+
+// fakeCompute is an evecompute.ServiceFunctions without compute instance.
+type fakeCompute struct {
+	evecompute.ServiceFunctions
+}
+
+func (fakeCompute) InstanceStatus(projectID, zone, name string) string {
+	return ""
+}
+
+func TestWithHooks(t *testing.T) {
+	out := t.TempDir() + "/hooks"
+
+	tests := []struct {
+		name       string
+		hooks      hooks
+		wantRun    bool
+		wantErr    bool
+		wantOutput string
+	}{
+		{
+			name: "Passing pre and post hooks",
+			hooks: hooks{
+				Pre:  []hook{{Command: "echo $GOEVE_PHASE $GOEVE_ACTION $GOEVE_LAB >> " + out}},
+				Post: []hook{{Command: "echo $GOEVE_PHASE $GOEVE_ACTION $GOEVE_LAB >> " + out}},
+			},
+			wantRun:    true,
+			wantOutput: "pre create lab1\npost create lab1\n",
+		},
+		{
+			name:    "Failing pre hook aborts the action",
+			hooks:   hooks{Pre: []hook{{Command: "exit 1"}}},
+			wantErr: true,
+		},
+		{
+			name:    "Passing ignored pre hook failure",
+			hooks:   hooks{Pre: []hook{{Command: "exit 1", IgnoreFailure: true}}},
+			wantRun: true,
+		},
+	}
+
+	for _, tc := range tests {
+		os.Remove(out)
+
+		c := &client{InstanceName: "lab1", Hooks: map[string]hooks{"create": tc.hooks}}
+
+		run := false
+		err := c.withHooks("create", fakeCompute{}, func() error {
+			run = true
+			return nil
+		})
+
+		if (err != nil) != tc.wantErr {
+			t.Errorf("withHooks() for %v returned error: %v, want error: %v", tc.name, err, tc.wantErr)
+		}
+
+		if run != tc.wantRun {
+			t.Errorf("withHooks() for %v ran the action: %v, want: %v", tc.name, run, tc.wantRun)
+		}
+
+		got, _ := ioutil.ReadFile(out)
+		if string(got) != tc.wantOutput {
+			t.Errorf("withHooks() for %v hooks wrote %q, want %q", tc.name, got, tc.wantOutput)
+		}
+	}
+}
+
+func TestSelectNodes(t *testing.T) {
+	nodes := []eveapi.Node{{ID: 1, Name: "R1"}, {ID: 2, Name: "R2"}, {ID: 3, Name: "SW1"}}
+
+	tests := []struct {
+		name    string
+		action  string
+		names   []string
+		all     bool
+		want    []eveapi.Node
+		wantErr bool
+	}{
+		{
+			name:   "Passing start without names",
+			action: "start",
+			want:   nodes,
+		},
+		{
+			name:   "Passing delete of all nodes",
+			action: "delete",
+			all:    true,
+			want:   nodes,
+		},
+		{
+			name:   "Passing nodes by name and id",
+			action: "wipe",
+			names:  []string{"SW1", "1"},
+			want:   []eveapi.Node{{ID: 3, Name: "SW1"}, {ID: 1, Name: "R1"}},
+		},
+		{
+			name:    "Failing wipe without names",
+			action:  "wipe",
+			wantErr: true,
+		},
+		{
+			name:    "Failing delete without names",
+			action:  "delete",
+			wantErr: true,
+		},
+		{
+			name:    "Failing names and all",
+			action:  "stop",
+			names:   []string{"R1"},
+			all:     true,
+			wantErr: true,
+		},
+		{
+			name:    "Failing unknown node",
+			action:  "start",
+			names:   []string{"R9"},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		got, err := selectNodes(nodes, tc.action, tc.names, tc.all)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("selectNodes() for %v returned error: %v, want error: %v", tc.name, err, tc.wantErr)
+		}
+
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("selectNodes() for %v returned unexpected diff (-want +got):\n%s", tc.name, diff)
+		}
+	}
+}
+
+func TestNodeAction(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/labs/ospf.unl/nodes/2/start" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code":400,"status":"fail","message":"Failed to start node (12)."}`))
+			return
+		}
+
+		w.Write([]byte(`{"code":200,"status":"success","message":"Node started (80049)."}`))
+	}))
+	defer s.Close()
+
+	api, err := eveapi.New(s.URL, s.Client())
+	if err != nil {
+		t.Fatalf("eveapi.New() returned error: %v", err)
+	}
+
+	want := []NodeResult{
+		{ID: 1, Name: "R1", Action: "start"},
+		{ID: 2, Name: "R2", Action: "start", Error: "eve-ng api error 400 fail: Failed to start node (12)."},
+		{ID: 3, Name: "R3", Action: "start"},
+	}
+
+	got, err := nodeAction(api, "/ospf.unl", "start", []eveapi.Node{{ID: 1, Name: "R1"}, {ID: 2, Name: "R2"}, {ID: 3, Name: "R3"}})
+	if err == nil {
+		t.Errorf("nodeAction() with a failing node returned no error")
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("nodeAction() returned unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestLoadTopology(t *testing.T) {
+	topo, err := loadTopology("../testdata/topology.yaml")
+	if err != nil {
+		t.Fatalf("loadTopology() returned error: %v", err)
+	}
+
+	networks, links := topo.desiredLinks()
+
+	wantNetworks := []topologyNetwork{
+		{Name: "mgmt", Type: "pnet1", Left: 300, Top: 50},
+		{Name: "R1:Gi0/0--R2:Gi0/0", Type: "bridge"},
+	}
+	if diff := cmp.Diff(wantNetworks, networks); diff != "" {
+		t.Errorf("desiredLinks() returned unexpected networks diff (-want +got):\n%s", diff)
+	}
+
+	wantLinks := map[string]string{
+		"R1:Gi0/0": "R1:Gi0/0--R2:Gi0/0",
+		"R2:Gi0/0": "R1:Gi0/0--R2:Gi0/0",
+		"R1:Gi0/1": "mgmt",
+		"R2:Gi0/1": "mgmt",
+	}
+	if diff := cmp.Diff(wantLinks, links); diff != "" {
+		t.Errorf("desiredLinks() returned unexpected links diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestTopologyValidate(t *testing.T) {
+	nodes := []topologyNode{{Name: "R1", Template: "vios"}, {Name: "R2", Template: "vios"}}
+
+	tests := []struct {
+		name    string
+		topo    topology
+		wantErr bool
+	}{
+		{
+			name: "Passing links",
+			topo: topology{Lab: "/ospf.unl", Nodes: nodes, Networks: []topologyNetwork{{Name: "mgmt"}}, Links: [][]string{{"R1:Gi0/0", "R2:Gi0/0"}, {"mgmt", "R1:Gi0/1"}}},
+		},
+		{
+			name:    "Failing lab path",
+			topo:    topology{Lab: "/team", Nodes: nodes},
+			wantErr: true,
+		},
+		{
+			name:    "Failing node without template",
+			topo:    topology{Lab: "/ospf.unl", Nodes: []topologyNode{{Name: "R1"}}},
+			wantErr: true,
+		},
+		{
+			name:    "Failing unknown node",
+			topo:    topology{Lab: "/ospf.unl", Nodes: nodes, Links: [][]string{{"R1:Gi0/0", "R3:Gi0/0"}}},
+			wantErr: true,
+		},
+		{
+			name:    "Failing interface linked twice",
+			topo:    topology{Lab: "/ospf.unl", Nodes: nodes, Links: [][]string{{"R1:Gi0/0", "R2:Gi0/0"}, {"R1:Gi0/0", "R2:Gi0/1"}}},
+			wantErr: true,
+		},
+		{
+			name:    "Failing unknown network",
+			topo:    topology{Lab: "/ospf.unl", Nodes: nodes, Links: [][]string{{"R1:Gi0/0", "mgmt"}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		if err := tc.topo.validate(); (err != nil) != tc.wantErr {
+			t.Errorf("validate() for %v returned error: %v, want error: %v", tc.name, err, tc.wantErr)
+		}
+	}
+}
+
+func TestPlan(t *testing.T) {
+	topo, err := loadTopology("../testdata/topology.yaml")
+	if err != nil {
+		t.Fatalf("loadTopology() returned error: %v", err)
+	}
+
+	empty := &labTopology{}
+
+	cur := &labTopology{
+		nodes: map[string]eveapi.Node{
+			"R1": {ID: 1, Name: "R1", Template: "vios", Type: "qemu", Image: "vios-adventerprisek9-m.spa.159-3.m4", RAM: 512, Ethernet: 4},
+			"R2": {ID: 2, Name: "R2", Template: "iosv", Type: "qemu"},
+			"R3": {ID: 3, Name: "R3", Template: "vios", Type: "qemu"},
+		},
+		networks: map[string]eveapi.Network{
+			"mgmt":               {ID: 1, Name: "mgmt", Type: "pnet1"},
+			"R1:Gi0/0--R2:Gi0/0": {ID: 2, Name: "R1:Gi0/0--R2:Gi0/0", Type: "bridge"},
+			"old":                {ID: 3, Name: "old", Type: "bridge"},
+		},
+		links: map[string]string{
+			"R1:Gi0/0": "R1:Gi0/0--R2:Gi0/0",
+			"R1:Gi0/1": "mgmt",
+			"R1:Gi0/2": "old",
+			"R1:Gi0/3": "mgmt",
+			"R3:Gi0/0": "mgmt",
+		},
+	}
+
+	tests := []struct {
+		name   string
+		cur    *labTopology
+		exists bool
+		prune  bool
+		want   []Change
+		// destructive is whether the plan needs a confirmation.
+		destructive bool
+	}{
+		{
+			name: "Passing new lab",
+			cur:  empty,
+			want: []Change{
+				{Action: "create", Kind: "lab", Name: "/team/ospf.unl"},
+				{Action: "create", Kind: "node", Name: "R1", Detail: "vios"},
+				{Action: "create", Kind: "node", Name: "R2", Detail: "vios"},
+				{Action: "create", Kind: "network", Name: "mgmt", Detail: "pnet1"},
+				{Action: "create", Kind: "network", Name: "R1:Gi0/0--R2:Gi0/0", Detail: "bridge"},
+				{Action: "connect", Kind: "link", Name: "R1:Gi0/0", Detail: "to R1:Gi0/0--R2:Gi0/0"},
+				{Action: "connect", Kind: "link", Name: "R1:Gi0/1", Detail: "to mgmt"},
+				{Action: "connect", Kind: "link", Name: "R2:Gi0/0", Detail: "to R1:Gi0/0--R2:Gi0/0"},
+				{Action: "connect", Kind: "link", Name: "R2:Gi0/1", Detail: "to mgmt"},
+			},
+		},
+		{
+			name:   "Passing existing lab",
+			cur:    cur,
+			exists: true,
+			want: []Change{
+				{Action: "update", Kind: "node", Name: "R1", Detail: "ram 512 to 1024"},
+				{Action: "replace", Kind: "node", Name: "R2", Detail: "iosv to vios"},
+				{Action: "connect", Kind: "link", Name: "R2:Gi0/0", Detail: "to R1:Gi0/0--R2:Gi0/0"},
+				{Action: "connect", Kind: "link", Name: "R2:Gi0/1", Detail: "to mgmt"},
+			},
+			destructive: true,
+		},
+		{
+			name:   "Passing existing lab with prune",
+			cur:    cur,
+			exists: true,
+			prune:  true,
+			want: []Change{
+				{Action: "update", Kind: "node", Name: "R1", Detail: "ram 512 to 1024"},
+				{Action: "replace", Kind: "node", Name: "R2", Detail: "iosv to vios"},
+				{Action: "delete", Kind: "node", Name: "R3"},
+				{Action: "delete", Kind: "network", Name: "old"},
+				{Action: "connect", Kind: "link", Name: "R2:Gi0/0", Detail: "to R1:Gi0/0--R2:Gi0/0"},
+				{Action: "connect", Kind: "link", Name: "R2:Gi0/1", Detail: "to mgmt"},
+				{Action: "disconnect", Kind: "link", Name: "R1:Gi0/3", Detail: "from mgmt"},
+			},
+			destructive: true,
+		},
+	}
+
+	for _, tc := range tests {
+		got := plan(topo, tc.cur, tc.exists, tc.prune)
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("plan() for %v returned unexpected diff (-want +got):\n%s", tc.name, diff)
+		}
+
+		r := &ApplyResult{Changes: got}
+		if r.Destructive() != tc.destructive {
+			t.Errorf("Destructive() for %v returned %v, want %v", tc.name, r.Destructive(), tc.destructive)
+		}
+	}
+}
+
+func TestExportLab(t *testing.T) {
+	unl := `<lab name="ospf" id="4e5b1d72-1c8f-4f2c-9d4e-2a7a5c0e9f11" version="1"/>`
+	sc := fakeSSH{files: map[string]string{labsDir + "/team/ospf.unl": unl}}
+
+	dir := t.TempDir()
+
+	tests := []struct {
+		name string
+		file string
+		want string
+	}{
+		{
+			name: "Passing file",
+			file: filepath.Join(dir, "saved.unl"),
+			want: filepath.Join(dir, "saved.unl"),
+		},
+		{
+			name: "Passing existing directory",
+			file: dir,
+			want: filepath.Join(dir, "ospf.unl"),
+		},
+	}
+
+	for _, tc := range tests {
+		got, err := exportLab(sc, "/team/ospf.unl", tc.file)
+		if err != nil {
+			t.Fatalf("exportLab() for %v returned error: %v", tc.name, err)
+		}
+
+		want := &LabTransfer{Lab: "/team/ospf.unl", File: tc.want, ID: "4e5b1d72-1c8f-4f2c-9d4e-2a7a5c0e9f11", Bytes: int64(len(unl))}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("exportLab() for %v returned unexpected diff (-want +got):\n%s", tc.name, diff)
+		}
+	}
+}
+
+func TestLabID(t *testing.T) {
+	unl := []byte(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<lab name="ospf" id="4e5b1d72-1c8f-4f2c-9d4e-2a7a5c0e9f11" version="1" scripttimeout="300" lock="0" author="eve">
+  <topology>
+    <nodes>
+      <node id="1" name="R1" type="qemu" template="vios" image="vios-15.6" uuid="0c1d2e3f-4a5b-4c6d-8e7f-8091a2b3c4d5"/>
+    </nodes>
+  </topology>
+</lab>
+`)
+
+	id, err := labID(unl)
+	if err != nil || id != "4e5b1d72-1c8f-4f2c-9d4e-2a7a5c0e9f11" {
+		t.Errorf("labID() returned %q, error: %v", id, err)
+	}
+
+	newID, err := newUUID()
+	if err != nil {
+		t.Fatalf("newUUID() returned error: %v", err)
+	}
+
+	if len(newID) != 36 || newID[14] != '4' {
+		t.Errorf("newUUID() returned %q, want a version 4 uuid", newID)
+	}
+
+	got := setLabID(unl, newID)
+	if id, _ := labID(got); id != newID {
+		t.Errorf("setLabID() set id %q, want %q", id, newID)
+	}
+
+	if !strings.Contains(string(got), `uuid="0c1d2e3f-4a5b-4c6d-8e7f-8091a2b3c4d5"`) {
+		t.Errorf("setLabID() changed the node uuid")
+	}
+
+	if _, err := labID([]byte("<lab/>")); err == nil {
+		t.Errorf("labID() of a lab without id returned no error")
+	}
+}
+
+func TestScrapeConsole(t *testing.T) {
+	consoleIdle = 200 * time.Millisecond
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen, error: %v", err)
+	}
+	defer l.Close()
+
+	// The fake console negotiates telnet options, echoes the commands and
+	// prints a running configuration.
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.Write([]byte{255, 251, 1, 255, 251, 3})
+		buf := make([]byte, 1024)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+
+			cmd := strings.TrimSpace(string(buf[:n]))
+			out := cmd + "\r\n"
+			if cmd == "show running-config" {
+				out += "Building configuration...\r\n\r\nhostname R1\r\n!\r\nend\r\n"
+			}
+			conn.Write([]byte(out + "R1#"))
+		}
+	}()
+
+	sc := fakeSSH{addrs: map[string]string{"127.0.0.1:32769": l.Addr().String()}}
+
+	addr, err := consolePort("telnet://10.0.0.1:32769")
+	if err != nil {
+		t.Fatalf("consolePort() returned error: %v", err)
+	}
+
+	got, err := scrapeConsole(sc, addr, commandsFor("vios"))
+	if err != nil {
+		t.Fatalf("scrapeConsole() returned error: %v", err)
+	}
+
+	want := "Building configuration...\n\nhostname R1\n!\nend\n"
+	if got != want {
+		t.Errorf("scrapeConsole() returned %q, want %q", got, want)
+	}
+
+	if got := commandsFor("vmxvcp"); got[len(got)-1] != "show configuration | no-more" {
+		t.Errorf("commandsFor(vmxvcp) returned %q", got)
+	}
+}
+
+func TestIsConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   bool
+	}{
+		{
+			name:   "Passing ios configuration",
+			output: "Building configuration...\n\nversion 15.6\nhostname R1\n!\nend\n",
+			want:   true,
+		},
+		{
+			name:   "Passing junos configuration",
+			output: "## Last commit: 2021-10-04 10:00:00 UTC by root\nversion 18.2R1.9;\nsystem {\n    host-name vMX1;\n}\n",
+			want:   true,
+		},
+		{
+			name:   "Passing vyos configuration",
+			output: "set system host-name 'vyos'\n",
+			want:   true,
+		},
+		{
+			name:   "Failing invalid input",
+			output: "             ^\n% Invalid input detected at '^' marker.\n",
+		},
+		{
+			name:   "Failing login prompt",
+			output: "\nvyos login: ",
+		},
+		{
+			name: "Failing empty output",
+		},
+	}
+
+	for _, tc := range tests {
+		if got := isConfig(tc.output); got != tc.want {
+			t.Errorf("isConfig() for %v returned %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestGitCommit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	// Without any git identity configured.
+	home := t.TempDir()
+	for k, v := range map[string]string{
+		"HOME":                home,
+		"XDG_CONFIG_HOME":     home,
+		"GIT_CONFIG_NOSYSTEM": "1",
+	} {
+		t.Setenv(k, v)
+	}
+
+	dir := t.TempDir()
+	ld := labDir(dir, "/team/ospf.unl")
+	if err := os.MkdirAll(ld, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(nodeFile(ld, "R1"), []byte("hostname R1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	commit, err := gitCommit(dir, "first backup")
+	if err != nil || commit == "" {
+		t.Fatalf("gitCommit() returned commit %q, error: %v", commit, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "team", "ospf", "R1.cfg")); err != nil {
+		t.Errorf("backup file is not in the lab directory, error: %v", err)
+	}
+
+	if commit, err := gitCommit(dir, "unchanged backup"); err != nil || commit != "" {
+		t.Errorf("gitCommit() without changes returned commit %q, error: %v", commit, err)
+	}
+}
+
+func TestBackupNodeNotRunning(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		config := ""
+		if r.URL.Path == "/api/labs/ospf.unl/configs/1" {
+			config = "hostname R1\n"
+		}
+
+		fmt.Fprintf(w, `{"code":200,"status":"success","data":{"id":1,"data":%q}}`, config)
+	}))
+	defer s.Close()
+
+	api, err := eveapi.New(s.URL, s.Client())
+	if err != nil {
+		t.Fatalf("eveapi.New() returned error: %v", err)
+	}
+
+	a := &apiSession{api: api}
+
+	tests := []struct {
+		name       string
+		node       eveapi.Node
+		want       string
+		wantMethod string
+		wantErr    bool
+	}{
+		{
+			name:       "Passing stopped node",
+			node:       eveapi.Node{ID: 1, Name: "R1", Status: eveapi.NodeStopped},
+			want:       "hostname R1\n",
+			wantMethod: backupStartup,
+		},
+		{
+			name:       "Failing stopped node without startup configuration",
+			node:       eveapi.Node{ID: 2, Name: "R2", Status: eveapi.NodeStopped},
+			wantMethod: backupSkipped,
+			wantErr:    true,
+		},
+	}
+
+	for _, tc := range tests {
+		got, method, err := a.backupNode("/ospf.unl", tc.node)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("backupNode() for %v returned error: %v, want error: %v", tc.name, err, tc.wantErr)
+		}
+
+		if got != tc.want || method != tc.wantMethod {
+			t.Errorf("backupNode() for %v returned %q with method %v, want %q with method %v", tc.name, got, method, tc.want, tc.wantMethod)
+		}
+	}
+}
+
+func TestMatchConfigs(t *testing.T) {
+	nodes := []eveapi.Node{
+		{ID: 1, Name: "R1", Status: eveapi.NodeStopped},
+		{ID: 2, Name: "core-R2", Status: eveapi.NodeStopped},
+		{ID: 3, Name: "R3", Status: eveapi.NodeRunning},
+		{ID: 5, Name: "core/R5", Status: eveapi.NodeStopped},
+	}
+
+	files := []string{"backup/R3.cfg", "backup/R1.cfg", "backup/R2.cfg", "backup/R4.cfg", nodeFile("backup", "core/R5")}
+	mapping := map[string]string{"R2": "core-R2"}
+
+	wantRestores := []NodeRestore{
+		{Name: "R1", File: "backup/R1.cfg"},
+		{Name: "core-R2", File: "backup/R2.cfg"},
+		{Name: "R3", File: "backup/R3.cfg", Error: "node is running, stop it before restoring its configuration"},
+		{Name: "R4", File: "backup/R4.cfg", Error: "no node R4 in the lab"},
+		{Name: "core/R5", File: "backup/core%2FR5.cfg"},
+	}
+	wantMatched := map[string]eveapi.Node{
+		"backup/R1.cfg":        nodes[0],
+		"backup/R2.cfg":        nodes[1],
+		"backup/core%2FR5.cfg": nodes[3],
+	}
+
+	restores, matched := matchConfigs(files, nodes, mapping)
+	if diff := cmp.Diff(wantRestores, restores); diff != "" {
+		t.Errorf("matchConfigs() returned unexpected restores diff (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(wantMatched, matched); diff != "" {
+		t.Errorf("matchConfigs() returned unexpected matches diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestImagePath(t *testing.T) {
+	tests := []struct {
+		name                      string
+		vendor, osName, ver, disk string
+		wantImage, wantPath       string
+		wantErr                   bool
+	}{
+		{
+			name:      "Passing boot disk",
+			vendor:    "cisco",
+			osName:    "csr1000v",
+			ver:       "17.3",
+			wantImage: "csr1000vng-17.3",
+			wantPath:  "/opt/unetlab/addons/qemu/csr1000vng-17.3/virtioa.qcow2",
+		},
+		{
+			name:      "Passing other disk",
+			vendor:    "Arista",
+			osName:    "vEOS",
+			ver:       "4.26.1F",
+			disk:      "cdrom.iso",
+			wantImage: "veos-4.26.1F",
+			wantPath:  "/opt/unetlab/addons/qemu/veos-4.26.1F/cdrom.iso",
+		},
+		{
+			name:    "Failing unknown os",
+			vendor:  "cisco",
+			osName:  "ios",
+			ver:     "15.1",
+			wantErr: true,
+		},
+		{
+			name:    "Failing version with a slash",
+			vendor:  "cisco",
+			osName:  "vios",
+			ver:     "../15.1",
+			wantErr: true,
+		},
+		{
+			name:    "Failing unknown disk",
+			vendor:  "cisco",
+			osName:  "vios",
+			ver:     "15.6",
+			disk:    "hda.qcow2",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		image, p, err := imagePath(tc.vendor, tc.osName, tc.ver, tc.disk)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("imagePath() for %v returned error: %v, want error: %v", tc.name, err, tc.wantErr)
+		}
+
+		if image != tc.wantImage || p != tc.wantPath {
+			t.Errorf("imagePath() for %v returned %q, %q, want %q, %q", tc.name, image, p, tc.wantImage, tc.wantPath)
+		}
+	}
+}
+
+func TestCheckImages(t *testing.T) {
+	tests := []struct {
+		name          string
+		entries       []string
+		wantImages    int
+		wantUnchecked []string
+		want          []ImageProblem
+	}{
+		{
+			name:       "Successful valid images",
+			entries:    []string{"vios-15.6/", "vios-15.6/virtioa.qcow2", "veos-4.26/", "veos-4.26/hda.qcow2", "veos-4.26/cdrom.iso"},
+			wantImages: 2,
+		},
+		{
+			name:    "Successful disk outside a folder",
+			entries: []string{"csr.qcow2"},
+			want: []ImageProblem{
+				{Path: "/opt/unetlab/addons/qemu/csr.qcow2", Problem: "disk outside an image folder, move it into a <prefix>-<version> folder"},
+			},
+		},
+		{
+			name:       "Successful folder without version",
+			entries:    []string{"vios/", "vios/virtioa.qcow2"},
+			wantImages: 1,
+			want: []ImageProblem{
+				{Path: "/opt/unetlab/addons/qemu/vios", Problem: "folder is not named <prefix>-<version>"},
+			},
+		},
+		{
+			name:          "Successful unknown prefix",
+			entries:       []string{"foo-1.0/", "foo-1.0/hda.qcow2"},
+			wantImages:    1,
+			wantUnchecked: []string{"/opt/unetlab/addons/qemu/foo-1.0"},
+		},
+		{
+			name:       "Successful aliased folder with a wrong disk name",
+			entries:    []string{"csr-17.3/", "csr-17.3/csr1000v-universalk9.qcow2"},
+			wantImages: 1,
+			want: []ImageProblem{
+				{
+					Path:    "/opt/unetlab/addons/qemu/csr-17.3/csr1000v-universalk9.qcow2",
+					Problem: "cisco csr1000v images boot from virtioa.qcow2",
+					Fix:     "sudo mv '/opt/unetlab/addons/qemu/csr-17.3/csr1000v-universalk9.qcow2' '/opt/unetlab/addons/qemu/csr-17.3/virtioa.qcow2'",
+				},
+				{
+					Path:    "/opt/unetlab/addons/qemu/csr-17.3",
+					Problem: "cisco csr1000v images need the csr1000vng prefix",
+					Fix:     "sudo mv -T '/opt/unetlab/addons/qemu/csr-17.3' '/opt/unetlab/addons/qemu/csr1000vng-17.3'",
+				},
+			},
+		},
+		{
+			name:       "Successful aliased folder of an existing image",
+			entries:    []string{"csr1000vng-17.3/", "csr1000vng-17.3/virtioa.qcow2", "csr1kv-17.3/", "csr1kv-17.3/virtioa.qcow2"},
+			wantImages: 2,
+			want: []ImageProblem{
+				{
+					Path:    "/opt/unetlab/addons/qemu/csr1kv-17.3",
+					Problem: "cisco csr1000v images need the csr1000vng prefix, but /opt/unetlab/addons/qemu/csr1000vng-17.3 already exists, merge them by hand",
+				},
+			},
+		},
+		{
+			name:          "Successful template prefixes",
+			entries:       []string{"asa-8.4/", "asa-8.4/hda.qcow2", "vsrx-12.1/", "vsrx-12.1/virtioa.qcow2"},
+			wantImages:    2,
+			wantUnchecked: []string{"/opt/unetlab/addons/qemu/asa-8.4", "/opt/unetlab/addons/qemu/vsrx-12.1"},
+		},
+		{
+			name:       "Successful disk to convert",
+			entries:    []string{"vios-15.6/", "vios-15.6/vios.vmdk"},
+			wantImages: 1,
+			want: []ImageProblem{
+				{Path: "/opt/unetlab/addons/qemu/vios-15.6", Problem: "missing boot disk virtioa.qcow2"},
+				{Path: "/opt/unetlab/addons/qemu/vios-15.6/vios.vmdk", Problem: "eve-ng does not use this file, upload it with image upload to convert it to virtioa.qcow2"},
+			},
+		},
+		{
+			name:       "Successful missing boot disk and unexpected files",
+			entries:    []string{"vios-15.6/", "vios-15.6/a.qcow2", "vios-15.6/b.qcow2"},
+			wantImages: 1,
+			want: []ImageProblem{
+				{Path: "/opt/unetlab/addons/qemu/vios-15.6", Problem: "missing boot disk virtioa.qcow2"},
+				{Path: "/opt/unetlab/addons/qemu/vios-15.6/a.qcow2", Problem: "eve-ng does not use this file, disks are named virtioa.qcow2"},
+				{Path: "/opt/unetlab/addons/qemu/vios-15.6/b.qcow2", Problem: "eve-ng does not use this file, disks are named virtioa.qcow2"},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		got := checkImages(tc.entries)
+		if got.Images != tc.wantImages {
+			t.Errorf("checkImages() for %v returned %v images, want %v", tc.name, got.Images, tc.wantImages)
+		}
+
+		if diff := cmp.Diff(tc.wantUnchecked, got.Unchecked); diff != "" {
+			t.Errorf("checkImages() for %v returned unexpected unchecked folders (-want +got):\n%s", tc.name, diff)
+		}
+
+		if diff := cmp.Diff(tc.want, got.Problems); diff != "" {
+			t.Errorf("checkImages() for %v returned unexpected diff (-want +got):\n%s", tc.name, diff)
+		}
+	}
+}
+
+func TestConvertImage(t *testing.T) {
+	tests := []struct {
+		name       string
+		src        string
+		outputs    map[string]string
+		failing    map[string]bool
+		wantFormat string
+		wantErr    bool
+	}{
+		{
+			name:       "Successful qcow2",
+			src:        "go-eve-images/vios-15.6/vios.qcow2",
+			outputs:    map[string]string{"/opt/qemu/bin/qemu-img info": `{"format": "qcow2"}`},
+			wantFormat: "qcow2",
+		},
+		{
+			name:       "Successful vmdk",
+			src:        "go-eve-images/vios-15.6/vios.vmdk",
+			outputs:    map[string]string{"/opt/qemu/bin/qemu-img info": `{"format": "vmdk"}`},
+			wantFormat: "vmdk",
+		},
+		{
+			name: "Successful ova",
+			src:  "go-eve-images/vios-15.6/vios.ova",
+			outputs: map[string]string{
+				"tar -tf":                     "vios.ovf\nvios.mf\nvios-disk1.vmdk\n",
+				"/opt/qemu/bin/qemu-img info": `{"format": "vmdk"}`,
+			},
+			wantFormat: "vmdk",
+		},
+		{
+			name: "Failing ova with several disks",
+			src:  "go-eve-images/vios-15.6/vios.ova",
+			outputs: map[string]string{
+				"tar -tf": "vios.ovf\nvios-disk1.vmdk\nvios-disk2.vmdk\n",
+			},
+			wantErr: true,
+		},
+		{
+			name:    "Failing check",
+			src:     "go-eve-images/vios-15.6/vios.vhd",
+			outputs: map[string]string{"/opt/qemu/bin/qemu-img info": `{"format": "vpc"}`},
+			failing: map[string]bool{"/opt/qemu/bin/qemu-img check 'go-eve-images/vios-15.6/virtioa.qcow2'; s=$?; [ $s -ne 3 ] || echo 'go-eve: leaked clusters'; [ $s -eq 0 ] || [ $s -eq 3 ]": true},
+			wantErr: true,
+		},
+		{
+			name: "Successful check with leaked clusters",
+			src:  "go-eve-images/vios-15.6/vios.vhd",
+			outputs: map[string]string{
+				"/opt/qemu/bin/qemu-img info":  `{"format": "vpc"}`,
+				"/opt/qemu/bin/qemu-img check": "12 leaked clusters were found on the image.\ngo-eve: leaked clusters\n",
+			},
+			wantFormat: "vpc",
+		},
+	}
+
+	for _, tc := range tests {
+		sc := fakeSSH{outputs: tc.outputs, failing: tc.failing}
+
+		format, err := convertImage(sc, tc.src, "go-eve-images/vios-15.6/virtioa.qcow2")
+		if (err != nil) != tc.wantErr {
+			t.Errorf("convertImage() for %v returned error %v, want error %v", tc.name, err, tc.wantErr)
+		}
+
+		if format != tc.wantFormat {
+			t.Errorf("convertImage() for %v returned format %q, want %q", tc.name, format, tc.wantFormat)
+		}
+	}
+}
+
+func TestEditionStatus(t *testing.T) {
+	license := ""
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/status" {
+			fmt.Fprintf(w, `{"code":200,"status":"success","data":{"version":"5.0.1-19","license":%q}}`, license)
+			return
+		}
+
+		w.Write([]byte(`{"code":200,"status":"success"}`))
+	}))
+	defer s.Close()
+
+	const (
+		dpkg = "dpkg-query -W -f='${Status}' eve-ng-pro | grep -q 'install ok installed'"
+		test = "sudo test -e '/opt/unetlab/eve-ng.lic'"
+	)
+
+	tests := []struct {
+		name        string
+		failing     map[string]bool
+		license     string
+		wantEdition string
+		wantLicense string
+	}{
+		{
+			name:        "Passing community",
+			failing:     map[string]bool{dpkg: true},
+			wantEdition: "community",
+			wantLicense: "not needed",
+		},
+		{
+			name:        "Passing pro without license",
+			failing:     map[string]bool{test: true},
+			wantEdition: "pro",
+			wantLicense: "missing",
+		},
+		{
+			name:        "Passing activated pro",
+			license:     "Valid",
+			wantEdition: "pro",
+			wantLicense: "activated",
+		},
+		{
+			name:        "Passing rejected license",
+			license:     "invalid",
+			wantEdition: "pro",
+			wantLicense: "not activated: invalid",
+		},
+		{
+			name:        "Passing unreported license",
+			wantEdition: "pro",
+			wantLicense: "unknown",
+		},
+	}
+
+	for _, tc := range tests {
+		license = tc.license
+
+		c := &client{EveSetup: eveSetup{AdminPassword: "secret"}}
+		c.EveSetup.setDefaults()
+
+		sc := fakeSSH{failing: tc.failing, addrs: map[string]string{"127.0.0.1:80": s.Listener.Addr().String()}}
+
+		edition, got := c.editionStatus(sc)
+		if edition != tc.wantEdition || got != tc.wantLicense {
+			t.Errorf("editionStatus() for %v returned %q, %q, want %q, %q", tc.name, edition, got, tc.wantEdition, tc.wantLicense)
+		}
+	}
+}
+
+func TestLoadLicense(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	if err := ioutil.WriteFile(filepath.Join(home, "eve-ng.lic"), []byte("license"), 0600); err != nil {
+		t.Fatalf("could not write the license file, error: %v", err)
+	}
+
+	e := eveSetup{Edition: "pro", LicenseFile: "~/eve-ng.lic"}
+	if err := e.loadLicense(); err != nil {
+		t.Fatalf("loadLicense() returned error: %v", err)
+	}
+
+	if want := "bGljZW5zZQ=="; e.License != want {
+		t.Errorf("loadLicense() read license %q, want %q", e.License, want)
+	}
+}
+
+// fakeInstances is a compute service whose instance has the status.
+type fakeInstances struct {
+	evecompute.ServiceFunctions
+	status string
+}
+
+func (f fakeInstances) InstanceStatus(projectID, zone, name string) string {
+	return f.status
+}
+
+func (f fakeInstances) CreateInstance(projectID, zone string, r *compute.Instance) error {
+	return nil
+}
+
+func TestCreateInstanceTrust(t *testing.T) {
+	tests := []struct {
+		name   string
+		status string
+		want   bool
+	}{
+		{
+			name: "Passing new instance",
+			want: true,
+		},
+		{
+			name:   "Passing existing instance",
+			status: "RUNNING",
+		},
+	}
+
+	for _, tc := range tests {
+		c, err := setup(t)
+		if err != nil {
+			t.Fatalf("could not create a new goeve client, error: %v", err)
+		}
+
+		if err := c.createInstance(fakeInstances{status: tc.status}); err != nil {
+			t.Fatalf("createInstance() for %v returned error: %v", tc.name, err)
+		}
+
+		if c.instanceCreated != tc.want {
+			t.Errorf("createInstance() for %v trusts a new host key: %v, want %v", tc.name, c.instanceCreated, tc.want)
+		}
+	}
+}
+
+func TestScriptOverride(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "install.sh")
+	if err := ioutil.WriteFile(file, []byte("echo {{.Hostname}} | jq '{{a: 1}}'\n"), 0644); err != nil {
+		t.Fatalf("could not write the script, error: %v", err)
+	}
+
+	c := &client{Scripts: map[string]string{"install.sh": file}}
+
+	got, err := c.script("install.sh")
+	if err != nil {
+		t.Fatalf("script() returned error: %v", err)
+	}
+
+	if want := "echo {{.Hostname}} | jq '{{a: 1}}'\n"; string(got) != want {
+		t.Errorf("script() returned %q, want the local script %q", got, want)
+	}
+
+	c.TemplateScripts = true
+	if _, err := c.script("install.sh"); err == nil {
+		t.Errorf("script() with templateScripts rendered an invalid template")
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	stopped := false
+	err := withTimeout(10*time.Millisecond, func(ctx context.Context) error {
+		<-ctx.Done()
+		stopped = true
+		return ctx.Err()
+	})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("withTimeout() of a blocked call returned error: %v, want a timeout", err)
+	}
+
+	if !stopped {
+		t.Errorf("withTimeout() returned before the call stopped")
+	}
+
+	want := errors.New("failed")
+	if err := withTimeout(time.Second, func(context.Context) error { return want }); err != want {
+		t.Errorf("withTimeout() returned error: %v, want %v", err, want)
+	}
+}
+
+func TestProvisionResumeSetup(t *testing.T) {
+	c, err := setup(t)
+	if err != nil {
+		t.Fatalf("could not create a new goeve client, error: %v", err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen, error: %v", err)
+	}
+	defer l.Close()
+
+	// The instance rebooted after install.sh and was left before
+	// eve-initial-setup.sh ran.
+	var done []string
+	for _, st := range defaultSteps[:4] {
+		m, err := c.marker(st)
+		if err != nil {
+			t.Fatalf("marker() returned error: %v", err)
+		}
+
+		done = append(done, m)
+	}
+
+	var calls []string
+	sc := fakeSSH{
+		outputs: map[string]string{"sudo cat " + markerFile: strings.Join(done, "\n") + "\n"},
+		addrs:   map[string]string{"127.0.0.1:80": l.Addr().String()},
+		calls:   &calls,
+	}
+
+	if _, err := c.provision(sc); err != nil {
+		t.Fatalf("provision() returned error: %v", err)
+	}
+
+	// The host keys eve-initial-setup.sh regenerates are pinned before the reboot.
+	want := []string{
+		"run eve-initial-setup.sh",
+		"pin host keys",
+		"rm -f ./'eve-initial-setup.sh'",
+		"reboot",
+		"upload eve-admin-password.sh",
+		"run eve-admin-password.sh",
+		"pin host keys",
+		"rm -f ./'eve-admin-password.sh'",
+	}
+
+	if diff := cmp.Diff(want, calls); diff != "" {
+		t.Errorf("provision() returned unexpected diff (-want +got):\n%s", diff)
+	}
+}
+
+// fakeGuest is an evecompute.ServiceFunctions whose compute instance has the
+// given guest attributes.
+type fakeGuest struct {
+	evecompute.ServiceFunctions
+	attrs map[string]string
+}
+
+func (f fakeGuest) GuestAttributes(projectID, zone, name, queryPath string) (map[string]string, error) {
+	return f.attrs, nil
+}
+
+func (fakeGuest) LookupExternalIP(projectID, zone, instanceName string) (net.Addr, error) {
+	return &net.IPAddr{IP: net.ParseIP("192.0.2.1")}, nil
+}
+
+func TestWaitForStartupScriptPinsHostKeys(t *testing.T) {
+	c, err := setup(t)
+	if err != nil {
+		t.Fatalf("could not create a new goeve client, error: %v", err)
+	}
+	c.StateDir = t.TempDir()
+	c.Status = &Status{}
+
+	// The key pinned before provisioning regenerated it.
+	if err := ioutil.WriteFile(c.knownHostsFile(), []byte("192.0.2.1 ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl\n"), 0600); err != nil {
+		t.Fatalf("could not write known_hosts, error: %v", err)
+	}
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate a host key, error: %v", err)
+	}
+
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatalf("could not generate a host key, error: %v", err)
+	}
+
+	s := fakeGuest{attrs: map[string]string{"status": "done", "hostkeys": string(ssh.MarshalAuthorizedKey(key))}}
+	if err := c.waitForStartupScript(s); err != nil {
+		t.Fatalf("waitForStartupScript() returned error: %v", err)
+	}
+
+	got, err := ioutil.ReadFile(c.knownHostsFile())
+	if err != nil {
+		t.Fatalf("could not read known_hosts, error: %v", err)
+	}
+
+	want := "192.0.2.1 " + string(ssh.MarshalAuthorizedKey(key))
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("waitForStartupScript() pinned unexpected host keys (-want +got):\n%s", diff)
+	}
+}
+
+func TestProvisionRemovesScripts(t *testing.T) {
+	c, err := setup(t)
+	if err != nil {
+		t.Fatalf("could not create a new goeve client, error: %v", err)
+	}
+
+	c.Provisioning = []step{
+		{Name: "upload install.sh", Type: stepUpload, Script: "install.sh"},
+		{Name: "run install.sh", Type: stepRun, Script: "install.sh"},
+		{Name: "run install.sh again", Type: stepRun, Script: "install.sh"},
+		{Name: "upload eve-initial-setup.sh", Type: stepUpload, Script: "eve-initial-setup.sh"},
+		{Name: "run eve-initial-setup.sh", Type: stepRun, Script: "eve-initial-setup.sh"},
+	}
+
+	var calls []string
+	var markers string
+	sc := fakeSSH{
+		failing: map[string]bool{"run eve-initial-setup.sh": true, "test -e " + legacyMarker: true},
+		calls:   &calls,
+		markers: &markers,
+	}
+
+	if _, err := c.provision(sc); err == nil {
+		t.Fatalf("provision() returned no error with a failing script")
+	}
+
+	// A script is removed after its last run, failed or not.
+	want := []string{
+		"test -e " + legacyMarker,
+		"upload install.sh",
+		"run install.sh",
+		"pin host keys",
+		"run install.sh",
+		"pin host keys",
+		"rm -f ./'install.sh'",
+		"upload eve-initial-setup.sh",
+		"run eve-initial-setup.sh",
+		"rm -f ./'eve-initial-setup.sh'",
+	}
+
+	if diff := cmp.Diff(want, calls); diff != "" {
+		t.Errorf("provision() returned unexpected diff (-want +got):\n%s", diff)
+	}
+
+	// A rerun uploads the removed script again.
+	if got := strings.Count(markers, "\n"); got != 3 {
+		t.Errorf("provision() left %d steps completed, want 3:\n%s", got, markers)
+	}
+}
+
+func TestProvisionResume(t *testing.T) {
+	c, err := setup(t)
+	if err != nil {
+		t.Fatalf("could not create a new goeve client, error: %v", err)
+	}
+
+	c.Provisioning = []step{
+		{Name: "upload install.sh", Type: stepUpload, Script: "install.sh"},
+		{Name: "run install.sh", Type: stepRun, Script: "install.sh"},
+		{Name: "reboot", Type: stepReboot},
+		{Name: "check", Type: stepAssertFileExists, Path: "/opt/ovf/.configured"},
+	}
+
+	var done []string
+	for _, st := range c.Provisioning {
+		m, err := c.marker(st)
+		if err != nil {
+			t.Fatalf("marker() returned error: %v", err)
+		}
+
+		done = append(done, m)
+	}
+
+	lines := func(markers ...string) string {
+		return strings.Join(markers, "\n") + "\n"
+	}
+
+	tests := []struct {
+		name      string
+		markers   string
+		want      []string
+		wantErr   error
+		wantAfter string
+	}{
+		{
+			name:    "Passing resume at the first incomplete step",
+			markers: lines(done[:2]...),
+			want: []string{
+				"reboot",
+				"test -e '/opt/ovf/.configured'",
+			},
+			wantAfter: lines(done...),
+		},
+		{
+			name:    "Passing changed script",
+			markers: lines("upload install.sh\t\told", "run install.sh\t\told", done[2], done[3]),
+			want: []string{
+				"upload install.sh",
+				"run install.sh",
+				"pin host keys",
+				"rm -f ./'install.sh'",
+				"reboot",
+				"test -e '/opt/ovf/.configured'",
+			},
+			wantAfter: lines(done...),
+		},
+		{
+			name:    "Passing bumped version",
+			markers: lines(done[0], done[1], "reboot\t1\t", done[3]),
+			want: []string{
+				"reboot",
+				"test -e '/opt/ovf/.configured'",
+			},
+			wantAfter: lines(done...),
+		},
+		{
+			name:      "Passing provisioned",
+			markers:   lines(done...),
+			wantErr:   errAlreadyConfigured,
+			wantAfter: lines(done...),
+		},
+	}
+
+	for _, tc := range tests {
+		var calls []string
+		markers := tc.markers
+		sc := fakeSSH{calls: &calls, markers: &markers}
+
+		if _, err := c.provision(sc); err != tc.wantErr {
+			t.Errorf("provision() for %v returned error: %v, want error: %v", tc.name, err, tc.wantErr)
+		}
+
+		if diff := cmp.Diff(tc.want, calls); diff != "" {
+			t.Errorf("provision() for %v returned unexpected diff (-want +got):\n%s", tc.name, diff)
+		}
+
+		if markers != tc.wantAfter {
+			t.Errorf("provision() for %v left markers %q, want %q", tc.name, markers, tc.wantAfter)
+		}
+	}
+}
+
+func TestProvisionRebootTimeout(t *testing.T) {
+	c, err := setup(t)
+	if err != nil {
+		t.Fatalf("could not create a new goeve client, error: %v", err)
+	}
+
+	c.Provisioning = []step{
+		{Name: "reboot", Type: stepReboot, Timeout: time.Minute, Retries: 1, RetryDelay: time.Millisecond},
+		{Name: "check", Type: stepAssertFileExists, Path: "/opt/ovf/.configured"},
+	}
+
+	var calls []string
+	markers := ""
+	sc := fakeSSH{
+		failing: map[string]bool{"reboot": true, "test -e " + legacyMarker: true},
+		calls:   &calls,
+		markers: &markers,
+	}
+
+	_, err = c.provision(sc)
+	if err == nil || !strings.Contains(err.Error(), `provisioning step "reboot" failed, error: 192.0.2.1 did not come back within 1m0s`) {
+		t.Errorf("provision() returned error: %v, want the reboot step timeout", err)
+	}
+
+	// The reboot is retried, and the steps after it do not run.
+	want := []string{"test -e " + legacyMarker, "reboot", "reboot"}
+	if diff := cmp.Diff(want, calls); diff != "" {
+		t.Errorf("provision() returned unexpected diff (-want +got):\n%s", diff)
+	}
+
+	if markers != "" {
+		t.Errorf("provision() recorded completed steps %q after a failed reboot", markers)
+	}
+}
@@ -0,0 +1,208 @@
+package goeve
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/amb1s1/go-eve/connect"
+	evecompute "github.com/amb1s1/go-eve/eve-compute"
+)
+
+// Lifecycle actions hooks run around.
+const (
+	actionCreate   = "create"
+	actionStop     = "stop"
+	actionReset    = "reset"
+	actionTeardown = "teardown"
+)
+
+// Hook phases.
+const (
+	phasePre  = "pre"
+	phasePost = "post"
+)
+
+// hook is a local command or a remote script run before or after an action.
+// Both get the lab name, ip, action and phase in the GOEVE_LAB, GOEVE_IP,
+// GOEVE_ACTION and GOEVE_PHASE environment variables.
+type hook struct {
+	Name string `yaml:"name"`
+	// Command is a local shell command.
+	Command string `yaml:"command"`
+	// Script is a script run as root on the compute instance, embedded or
+	// set in the scripts config like the provisioning scripts.
+	Script string `yaml:"script"`
+	// Timeout limits the hook, it defaults to the provisioning step timeout.
+	Timeout time.Duration `yaml:"timeout"`
+	// IgnoreFailure logs a failure instead of aborting the action.
+	IgnoreFailure bool `yaml:"ignoreFailure"`
+}
+
+// hooks are the hooks of an action.
+type hooks struct {
+	Pre  []hook `yaml:"pre"`
+	Post []hook `yaml:"post"`
+}
+
+// noInstance are the action phases when the compute instance may not run, so
+// remote scripts cannot.
+var noInstance = map[string]bool{
+	actionCreate + " " + phasePre:    true,
+	actionStop + " " + phasePost:     true,
+	actionTeardown + " " + phasePost: true,
+}
+
+func (h hook) timeout() time.Duration {
+	if h.Timeout > 0 {
+		return h.Timeout
+	}
+
+	return defaultStepTimeout
+}
+
+// validateHooks verifies the hooks are on known actions, and every hook is
+// either a command or a script the compute instance can run.
+func validateHooks(actions map[string]hooks) error {
+	for action, hs := range actions {
+		switch action {
+		case actionCreate, actionStop, actionReset, actionTeardown:
+		default:
+			return fmt.Errorf("hooks: unknown action %q", action)
+		}
+
+		for phase, list := range map[string][]hook{phasePre: hs.Pre, phasePost: hs.Post} {
+			for i, h := range list {
+				if (h.Command == "") == (h.Script == "") {
+					return fmt.Errorf("hooks: %v %v hook %d needs either a command or a script", phase, action, i)
+				}
+
+				if h.Script != "" && noInstance[action+" "+phase] {
+					return fmt.Errorf("hooks: %v %v hook %d cannot run a script, the instance may not run", phase, action, i)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// withHooks runs the pre hooks of action, action itself, then its post hooks.
+// A failing pre hook aborts the action.
+func (c *client) withHooks(action string, s evecompute.ServiceFunctions, f func() error) error {
+	if err := c.runHooks(action, phasePre, s); err != nil {
+		return err
+	}
+
+	if err := f(); err != nil {
+		return err
+	}
+
+	return c.runHooks(action, phasePost, s)
+}
+
+// runHooks runs the hooks of the action phase in order.
+func (c *client) runHooks(action, phase string, s evecompute.ServiceFunctions) error {
+	var list []hook
+	if phase == phasePre {
+		list = c.Hooks[action].Pre
+	} else {
+		list = c.Hooks[action].Post
+	}
+
+	if len(list) == 0 {
+		return nil
+	}
+
+	ip := ""
+	if s.InstanceStatus(c.ProjectID, c.Zone, c.InstanceName) == "RUNNING" {
+		if addr, err := s.LookupExternalIP(c.ProjectID, c.Zone, c.InstanceName); err == nil && addr != nil {
+			ip = addr.String()
+		}
+	}
+
+	env := []string{
+		"GOEVE_LAB=" + c.InstanceName,
+		"GOEVE_IP=" + ip,
+		"GOEVE_ACTION=" + action,
+		"GOEVE_PHASE=" + phase,
+	}
+
+	var sc connect.Functions
+	for i, h := range list {
+		name := h.Name
+		if name == "" {
+			name = fmt.Sprintf("%v %v hook %d", phase, action, i)
+		}
+
+		log.Printf("Running hook %q", name)
+
+		var err error
+		if h.Command != "" {
+			err = runLocalHook(h, env)
+		} else {
+			if sc == nil {
+				if sc, err = c.sshClient(s); err != nil {
+					return fmt.Errorf("could not run hook %q, error: %v", name, err)
+				}
+			}
+
+			err = c.runRemoteHook(sc, h, env)
+		}
+
+		if err == nil {
+			continue
+		}
+
+		if h.IgnoreFailure {
+			log.Printf("Hook %q failed, ignoring, error: %v", name, err)
+			continue
+		}
+
+		return fmt.Errorf("hook %q failed, error: %v", name, err)
+	}
+
+	return nil
+}
+
+// runLocalHook runs the hook command with the local shell.
+func runLocalHook(h hook, env []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout())
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", h.Command)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
+
+// runRemoteHook uploads the hook script and runs it as root on the compute instance.
+func (c *client) runRemoteHook(sc connect.Functions, h hook, env []string) error {
+	script, err := c.script(h.Script)
+	if err != nil {
+		return err
+	}
+
+	if err := sc.Upload(h.Script, script); err != nil {
+		return err
+	}
+
+	var vars []string
+	for _, e := range env {
+		vars = append(vars, connect.ShellQuote(e))
+	}
+
+	f := "./" + connect.ShellQuote(h.Script)
+	cmd := fmt.Sprintf("chmod +x %v && sudo env %v timeout --kill-after=30 %d %v", f, strings.Join(vars, " "), int(h.timeout().Seconds()), f)
+	if out, err := sc.Run(cmd); err != nil {
+		return fmt.Errorf("%v, output: %s", err, out)
+	}
+
+	return nil
+}
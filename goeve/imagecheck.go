@@ -0,0 +1,243 @@
+package goeve
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/amb1s1/go-eve/connect"
+)
+
+// eveDiskPattern matches the disk file names eve-ng attaches to qemu nodes.
+var eveDiskPattern = regexp.MustCompile(`^((hd|virtio|sata|scsi)[a-z]\.qcow2|cdrom\.iso)$`)
+
+// ImageProblem is a wrongly named or misplaced image file or folder, with the
+// command fixing it when go-eve knows it.
+type ImageProblem struct {
+	Path    string
+	Problem string
+	Fix     string `json:",omitempty"`
+}
+
+// ImageCheck reports the problems of the qemu images of the compute instance.
+type ImageCheck struct {
+	Images int
+	// Unchecked are the image folders whose prefix is not in the go-eve
+	// catalog, e.g. other eve-ng templates, which go-eve does not check.
+	Unchecked []string `json:",omitempty"`
+	Problems  []ImageProblem
+	Fixed     bool `json:",omitempty"`
+}
+
+// listImages returns the folders, with a trailing slash, and the files of the
+// qemu images, relative to qemuDir.
+func listImages(sc connect.Functions) ([]string, error) {
+	out, err := sc.Run("sudo find " + qemuDir + " -mindepth 1 -maxdepth 2 -printf '%y %P\\n'")
+	if err != nil {
+		return nil, fmt.Errorf("could not list the images in %v, error: %v, output: %s", qemuDir, err, out)
+	}
+
+	var entries []string
+
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		fields := strings.SplitN(s.Text(), " ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+
+		if fields[0] == "d" {
+			fields[1] += "/"
+		}
+
+		entries = append(entries, fields[1])
+	}
+
+	return entries, s.Err()
+}
+
+// ruleForFolder returns the naming rule of the image folder, and whether the
+// folder prefix is the rule one rather than a wrong alias of it.
+func ruleForFolder(prefix string) (imageRule, bool, bool) {
+	for _, r := range imageCatalog {
+		if r.Prefix == prefix {
+			return r, true, true
+		}
+	}
+
+	for _, r := range imageCatalog {
+		if strings.EqualFold(r.Prefix, prefix) {
+			return r, false, true
+		}
+
+		for _, a := range r.Aliases {
+			if strings.EqualFold(a, prefix) {
+				return r, false, true
+			}
+		}
+	}
+
+	return imageRule{}, false, false
+}
+
+// checkImages returns the problems of the qemu image entries, as listImages
+// returns them. The fixes apply in order.
+func checkImages(entries []string) *ImageCheck {
+	check := &ImageCheck{}
+	files := map[string][]string{}
+	var folders []string
+	var problems []ImageProblem
+
+	for _, e := range entries {
+		switch dir, file := path.Split(e); {
+		case file == "":
+			folders = append(folders, strings.TrimSuffix(dir, "/"))
+		case dir == "":
+			problems = append(problems, ImageProblem{
+				Path:    path.Join(qemuDir, file),
+				Problem: "disk outside an image folder, move it into a <prefix>-<version> folder",
+			})
+		default:
+			dir = strings.TrimSuffix(dir, "/")
+			files[dir] = append(files[dir], file)
+		}
+	}
+
+	sort.Strings(folders)
+
+	exists := map[string]bool{}
+	for _, f := range folders {
+		exists[f] = true
+	}
+
+	for _, f := range folders {
+		p := path.Join(qemuDir, f)
+
+		i := strings.Index(f, "-")
+		if i <= 0 || i == len(f)-1 {
+			problems = append(problems, ImageProblem{Path: p, Problem: "folder is not named <prefix>-<version>"})
+			continue
+		}
+
+		prefix, version := f[:i], f[i+1:]
+
+		r, exact, ok := ruleForFolder(prefix)
+		if !ok {
+			check.Unchecked = append(check.Unchecked, p)
+			continue
+		}
+
+		problems = append(problems, checkDisks(p, r, files[f])...)
+
+		if exact {
+			continue
+		}
+
+		dst := r.Prefix + "-" + version
+		problem := ImageProblem{Path: p, Problem: fmt.Sprintf("%v %v images need the %v prefix", r.Vendor, r.OS, r.Prefix)}
+
+		// mv would move the folder into an existing dst, not rename it.
+		if exists[dst] {
+			problem.Problem += ", but " + path.Join(qemuDir, dst) + " already exists, merge them by hand"
+		} else {
+			problem.Fix = fmt.Sprintf("sudo mv -T %v %v", connect.ShellQuote(p), connect.ShellQuote(path.Join(qemuDir, dst)))
+			exists[dst] = true
+		}
+
+		problems = append(problems, problem)
+	}
+
+	check.Images, check.Problems = len(folders), problems
+
+	return check
+}
+
+// checkDisks returns the problems of the disk files of the image folder dir.
+func checkDisks(dir string, r imageRule, files []string) []ImageProblem {
+	var problems []ImageProblem
+
+	boot := r.Disks[0]
+	hasBoot := false
+	var unexpected []string
+	for _, f := range files {
+		known := eveDiskPattern.MatchString(f)
+		for _, d := range r.Disks {
+			known = known || f == d
+		}
+
+		hasBoot = hasBoot || f == boot
+		if !known {
+			unexpected = append(unexpected, f)
+		}
+	}
+
+	sort.Strings(unexpected)
+
+	// Only a disk of the boot disk type is renamed, other formats need the
+	// conversion of image upload.
+	if !hasBoot && len(unexpected) == 1 && strings.EqualFold(path.Ext(unexpected[0]), path.Ext(boot)) {
+		src, dst := path.Join(dir, unexpected[0]), path.Join(dir, boot)
+		return append(problems, ImageProblem{
+			Path:    src,
+			Problem: fmt.Sprintf("%v %v images boot from %v", r.Vendor, r.OS, boot),
+			Fix:     fmt.Sprintf("sudo mv %v %v", connect.ShellQuote(src), connect.ShellQuote(dst)),
+		})
+	}
+
+	if !hasBoot {
+		problems = append(problems, ImageProblem{Path: dir, Problem: "missing boot disk " + boot})
+	}
+
+	for _, f := range unexpected {
+		problem := "eve-ng does not use this file, disks are named " + strings.Join(r.Disks, ", ")
+		if ext := strings.ToLower(path.Ext(f)); ext != ".qcow2" && ext != ".iso" {
+			problem = "eve-ng does not use this file, upload it with image upload to convert it to " + boot
+		}
+
+		problems = append(problems, ImageProblem{Path: path.Join(dir, f), Problem: problem})
+	}
+
+	return problems
+}
+
+// CheckImages reports the wrongly named or misplaced qemu images of the
+// compute instance, and with fix, runs the known fixes.
+func CheckImages(instanceName, configFile string, fix bool) (*ImageCheck, error) {
+	sc, err := labSSH(instanceName, configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := listImages(sc)
+	if err != nil {
+		return nil, err
+	}
+
+	r := checkImages(entries)
+
+	if !fix {
+		return r, nil
+	}
+
+	for _, p := range r.Problems {
+		if p.Fix == "" {
+			continue
+		}
+
+		if out, err := sc.Run(p.Fix); err != nil {
+			return r, fmt.Errorf("could not fix %v, error: %v, output: %s", p.Path, err, out)
+		}
+	}
+
+	if err := fixPermissions(sc); err != nil {
+		return r, err
+	}
+
+	r.Fixed = true
+
+	return r, nil
+}
@@ -0,0 +1,180 @@
+package goeve
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/amb1s1/go-eve/connect"
+)
+
+// qemuDir is where eve-ng looks for the qemu images, one folder per image.
+var qemuDir = "/opt/unetlab/addons/qemu"
+
+// imageStaging is where images are uploaded over sftp, relative to the ssh
+// user home, before they move into qemuDir.
+var imageStaging = "go-eve-images"
+
+// imageVersionPattern matches the versions allowed in image folder names.
+var imageVersionPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// imageRule is the eve-ng naming rule of the images of a vendor os.
+type imageRule struct {
+	Vendor string
+	OS     string
+	// Prefix starts the image folder name, followed by a dash and the version.
+	Prefix string
+	// Disks are the disk file names in the image folder, the first one boots.
+	Disks []string
+	// Aliases are prefixes the images of the os are often wrongly named with.
+	// Prefixes of eve-ng templates, e.g. asa or vsrx, are never aliases.
+	Aliases []string
+}
+
+// imageCatalog are the eve-ng naming rules of the qemu images.
+var imageCatalog = []imageRule{
+	{Vendor: "cisco", OS: "vios", Prefix: "vios", Disks: []string{"virtioa.qcow2"}, Aliases: []string{"iosv"}},
+	{Vendor: "cisco", OS: "viosl2", Prefix: "viosl2", Disks: []string{"virtioa.qcow2"}, Aliases: []string{"iosvl2"}},
+	{Vendor: "cisco", OS: "csr1000v", Prefix: "csr1000vng", Disks: []string{"virtioa.qcow2"}, Aliases: []string{"csr1kv", "csr"}},
+	{Vendor: "cisco", OS: "csr1000v-denali", Prefix: "csr1000v", Disks: []string{"virtioa.qcow2"}},
+	{Vendor: "cisco", OS: "c8000v", Prefix: "c8000v", Disks: []string{"virtioa.qcow2"}, Aliases: []string{"cat8kv", "c8kv"}},
+	{Vendor: "cisco", OS: "asav", Prefix: "asav", Disks: []string{"virtioa.qcow2"}},
+	{Vendor: "cisco", OS: "xrv", Prefix: "xrv", Disks: []string{"hda.qcow2"}, Aliases: []string{"iosxrv"}},
+	{Vendor: "cisco", OS: "xrv9k", Prefix: "xrv9k", Disks: []string{"virtioa.qcow2"}, Aliases: []string{"xrv9000", "iosxrv9k"}},
+	{Vendor: "cisco", OS: "nxosv", Prefix: "titanium", Disks: []string{"virtioa.qcow2"}, Aliases: []string{"nxos"}},
+	{Vendor: "cisco", OS: "nxosv9k", Prefix: "nxosv9k", Disks: []string{"sataa.qcow2"}, Aliases: []string{"n9kv", "nexus9k", "nxos9k"}},
+	{Vendor: "arista", OS: "veos", Prefix: "veos", Disks: []string{"hda.qcow2", "cdrom.iso"}, Aliases: []string{"arista", "eos"}},
+	{Vendor: "juniper", OS: "vmx-vcp", Prefix: "vmxvcp", Disks: []string{"virtioa.qcow2", "virtiob.qcow2", "virtioc.qcow2"}},
+	{Vendor: "juniper", OS: "vmx-vfp", Prefix: "vmxvfp", Disks: []string{"virtioa.qcow2"}},
+	{Vendor: "juniper", OS: "vsrx", Prefix: "vsrxng", Disks: []string{"virtioa.qcow2"}},
+	{Vendor: "juniper", OS: "vqfx-re", Prefix: "vqfxre", Disks: []string{"hda.qcow2"}},
+	{Vendor: "juniper", OS: "vqfx-pfe", Prefix: "vqfxpfe", Disks: []string{"hda.qcow2"}},
+	{Vendor: "fortinet", OS: "fortigate", Prefix: "fortinet", Disks: []string{"virtioa.qcow2"}, Aliases: []string{"fortigate", "fgt"}},
+	{Vendor: "paloalto", OS: "panos", Prefix: "paloalto", Disks: []string{"virtioa.qcow2"}, Aliases: []string{"panos", "pan"}},
+	{Vendor: "f5", OS: "bigip", Prefix: "bigip", Disks: []string{"hda.qcow2", "hdb.qcow2"}, Aliases: []string{"f5"}},
+	{Vendor: "mikrotik", OS: "routeros", Prefix: "mikrotik", Disks: []string{"hda.qcow2"}, Aliases: []string{"chr", "routeros"}},
+	{Vendor: "vyos", OS: "vyos", Prefix: "vyos", Disks: []string{"virtioa.qcow2"}},
+	{Vendor: "linux", OS: "linux", Prefix: "linux", Disks: []string{"virtioa.qcow2"}, Aliases: []string{"ubuntu", "debian", "centos"}},
+	{Vendor: "microsoft", OS: "windows", Prefix: "win", Disks: []string{"hda.qcow2"}, Aliases: []string{"windows"}},
+}
+
+// ImageUpload reports an uploaded image.
+type ImageUpload struct {
+	Image string
+	Path  string
+	Bytes int64
+	// ConvertedFrom is the format the file was converted to qcow2 from.
+	ConvertedFrom string `json:",omitempty"`
+}
+
+// findImageRule returns the naming rule of the vendor os.
+func findImageRule(vendor, osName string) (imageRule, error) {
+	var known []string
+	for _, r := range imageCatalog {
+		if strings.EqualFold(r.Vendor, vendor) && strings.EqualFold(r.OS, osName) {
+			return r, nil
+		}
+
+		known = append(known, r.Vendor+"/"+r.OS)
+	}
+
+	sort.Strings(known)
+
+	return imageRule{}, fmt.Errorf("unknown image vendor %q and os %q, known: %v", vendor, osName, strings.Join(known, ", "))
+}
+
+// imagePath returns the image folder and the path of the disk of the vendor
+// os version. An empty disk is the boot disk.
+func imagePath(vendor, osName, version, disk string) (string, string, error) {
+	r, err := findImageRule(vendor, osName)
+	if err != nil {
+		return "", "", err
+	}
+
+	if !imageVersionPattern.MatchString(version) {
+		return "", "", fmt.Errorf("invalid image version %q", version)
+	}
+
+	if disk == "" {
+		disk = r.Disks[0]
+	}
+
+	found := false
+	for _, d := range r.Disks {
+		found = found || d == disk
+	}
+
+	if !found {
+		return "", "", fmt.Errorf("%v %v images have no disk %v, want one of %v", vendor, osName, disk, strings.Join(r.Disks, ", "))
+	}
+
+	image := r.Prefix + "-" + version
+
+	return image, path.Join(qemuDir, image, disk), nil
+}
+
+// fixPermissions fixes the ownership and permissions of the eve-ng files.
+func fixPermissions(sc connect.Functions) error {
+	if out, err := sc.Run("sudo /opt/unetlab/wrappers/unl_wrapper -a fixpermissions"); err != nil {
+		return fmt.Errorf("could not fix the eve-ng permissions, error: %v, output: %s", err, out)
+	}
+
+	return nil
+}
+
+// UploadImage uploads the local disk file as the image of the vendor os
+// version, named as eve-ng expects. VMDK, OVA and VHD files of qcow2 disks are
+// converted on the compute instance. An existing disk is only replaced with force.
+func UploadImage(instanceName, configFile, file, vendor, osName, version, disk string, force bool) (*ImageUpload, error) {
+	image, dst, err := imagePath(vendor, osName, version, disk)
+	if err != nil {
+		return nil, err
+	}
+
+	sc, err := labSSH(instanceName, configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := sc.Run("sudo test -e " + connect.ShellQuote(dst)); err == nil && !force {
+		return nil, fmt.Errorf("image disk %v already exists, upload with force to replace it", dst)
+	}
+
+	staging := path.Join(imageStaging, image, path.Base(dst))
+	upload := staging
+	if path.Ext(dst) == ".qcow2" {
+		upload = path.Join(imageStaging, image, filepath.Base(file))
+	}
+
+	r, err := sc.Push(file, upload, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var converted string
+	if upload != staging {
+		format, err := convertImage(sc, upload, staging)
+		if err != nil {
+			return nil, err
+		}
+
+		if format != "qcow2" {
+			converted = format
+		}
+	}
+
+	cmd := fmt.Sprintf("sudo mkdir -p %v && sudo mv -f %v %v && rm -rf %v",
+		connect.ShellQuote(path.Dir(dst)), connect.ShellQuote(staging), connect.ShellQuote(dst), connect.ShellQuote(path.Join(imageStaging, image)))
+	if out, err := sc.Run(cmd); err != nil {
+		return nil, fmt.Errorf("could not move the image into %v, error: %v, output: %s", path.Dir(dst), err, out)
+	}
+
+	if err := fixPermissions(sc); err != nil {
+		return nil, err
+	}
+
+	return &ImageUpload{Image: image, Path: dst, Bytes: r.Bytes, ConvertedFrom: converted}, nil
+}
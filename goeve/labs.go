@@ -0,0 +1,107 @@
+package goeve
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/amb1s1/go-eve/eveapi"
+)
+
+// LabChange reports a change of an eve-ng lab or folder.
+type LabChange struct {
+	Path   string
+	Action string
+	To     string `json:",omitempty"`
+}
+
+// isLab returns whether the eve-ng path is a lab file rather than a folder.
+func isLab(p string) bool {
+	return strings.HasSuffix(p, ".unl")
+}
+
+// cleanPath returns the eve-ng path p, absolute and without trailing slash.
+func cleanPath(p string) string {
+	return path.Clean("/" + p)
+}
+
+// ListLabs returns the folders and eve-ng labs in the folder at p.
+func ListLabs(instanceName, configFile, p string) (*eveapi.Folder, error) {
+	a, err := newAPISession(instanceName, configFile)
+	if err != nil {
+		return nil, err
+	}
+	defer a.close()
+
+	return a.api.Folder(cleanPath(p))
+}
+
+// CreateLab creates the eve-ng lab, when p ends with .unl, or the folder at p.
+func CreateLab(instanceName, configFile, p, author, description string) (*LabChange, error) {
+	a, err := newAPISession(instanceName, configFile)
+	if err != nil {
+		return nil, err
+	}
+	defer a.close()
+
+	p = cleanPath(p)
+	dir, name := path.Split(p)
+
+	if isLab(p) {
+		l := eveapi.Lab{Name: strings.TrimSuffix(name, ".unl"), Author: author, Description: description}
+		if err := a.api.CreateLab(dir, l); err != nil {
+			return nil, fmt.Errorf("could not create lab %v, error: %v", p, err)
+		}
+	} else if err := a.api.CreateFolder(dir, name); err != nil {
+		return nil, fmt.Errorf("could not create folder %v, error: %v", p, err)
+	}
+
+	return &LabChange{Path: p, Action: "created"}, nil
+}
+
+// DeleteLab deletes the eve-ng lab, or the folder with its labs, at p.
+func DeleteLab(instanceName, configFile, p string) (*LabChange, error) {
+	a, err := newAPISession(instanceName, configFile)
+	if err != nil {
+		return nil, err
+	}
+	defer a.close()
+
+	p = cleanPath(p)
+
+	if isLab(p) {
+		err = a.api.DeleteLab(p)
+	} else {
+		err = a.api.DeleteFolder(p)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("could not delete %v, error: %v", p, err)
+	}
+
+	return &LabChange{Path: p, Action: "deleted"}, nil
+}
+
+// MoveLab moves the eve-ng lab at p into the folder to, or moves and renames
+// the folder at p to the path to.
+func MoveLab(instanceName, configFile, p, to string) (*LabChange, error) {
+	a, err := newAPISession(instanceName, configFile)
+	if err != nil {
+		return nil, err
+	}
+	defer a.close()
+
+	p, to = cleanPath(p), cleanPath(to)
+
+	if isLab(p) {
+		err = a.api.MoveLab(p, to)
+	} else {
+		err = a.api.MoveFolder(p, to)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("could not move %v to %v, error: %v", p, to, err)
+	}
+
+	return &LabChange{Path: p, Action: "moved", To: to}, nil
+}
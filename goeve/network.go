@@ -0,0 +1,123 @@
+package goeve
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	compute "google.golang.org/api/compute/v1"
+)
+
+const (
+	// maxPnet is the last eve-ng cloud bridge, pnet0 is the management bridge on eth0.
+	maxPnet = 9
+	// maxNetworkInterfaces is the number of network interfaces a google cloud instance can have.
+	maxNetworkInterfaces = 8
+)
+
+// networkInterface is an extra network interface of the compute instance,
+// bridged to an eve-ng cloud, so lab nodes connected to the pnet cloud reach
+// the network.
+type networkInterface struct {
+	Network    string `yaml:"network"`
+	Subnet     string `yaml:"subnet"`
+	ExternalIP bool   `yaml:"externalIP"`
+	Pnet       int    `yaml:"pnet"`
+}
+
+// cloudBridge is an eve-ng pnet bridge and its port, rendered into eve-initial-setup.sh.
+type cloudBridge struct {
+	Pnet int
+	Port string
+}
+
+// validateNetworkInterfaces verifies every extra network interface is in its
+// own network and mapped to its own pnet bridge.
+func validateNetworkInterfaces(nics []networkInterface) error {
+	if len(nics) > maxNetworkInterfaces-1 {
+		return fmt.Errorf("networkInterfaces: at most %d extra network interfaces are supported", maxNetworkInterfaces-1)
+	}
+
+	networks := map[string]bool{"default": true}
+	pnets := map[int]bool{}
+
+	for _, n := range nics {
+		if n.Network == "" {
+			return fmt.Errorf("networkInterfaces: a network interface has no network")
+		}
+
+		if networks[n.Network] {
+			return fmt.Errorf("networkInterfaces: network %v has more than one network interface", n.Network)
+		}
+		networks[n.Network] = true
+
+		if n.Pnet < 1 || n.Pnet > maxPnet {
+			return fmt.Errorf("networkInterfaces: pnet of network %v must be between 1 and %d", n.Network, maxPnet)
+		}
+
+		if pnets[n.Pnet] {
+			return fmt.Errorf("networkInterfaces: pnet%d has more than one network interface", n.Pnet)
+		}
+		pnets[n.Pnet] = true
+	}
+
+	return nil
+}
+
+// cloudBridges returns the ports of the pnet1 to pnet9 bridges. The extra
+// network interfaces are eth1, eth2, ... in order, and bridged to their pnet.
+// Any other pnetN keeps ethN as its port, unless ethN is bridged elsewhere.
+func cloudBridges(nics []networkInterface) []cloudBridge {
+	ports := map[int]string{}
+	used := map[string]bool{}
+
+	for i, n := range nics {
+		eth := "eth" + strconv.Itoa(i+1)
+		ports[n.Pnet] = eth
+		used[eth] = true
+	}
+
+	var bridges []cloudBridge
+	for p := 1; p <= maxPnet; p++ {
+		port, ok := ports[p]
+		if !ok {
+			port = "eth" + strconv.Itoa(p)
+			if used[port] {
+				port = "none"
+			}
+		}
+
+		bridges = append(bridges, cloudBridge{Pnet: p, Port: port})
+	}
+
+	return bridges
+}
+
+// networkInterfaceRequests returns the extra network interfaces of the instance request.
+func (c *client) networkInterfaceRequests(prefix string) []*compute.NetworkInterface {
+	region := c.Zone[:strings.LastIndex(c.Zone, "-")]
+
+	var r []*compute.NetworkInterface
+	for _, n := range c.NetworkInterfaces {
+		ni := &compute.NetworkInterface{
+			Network: prefix + "/global/networks/" + n.Network,
+		}
+
+		if n.Subnet != "" {
+			ni.Subnetwork = prefix + "/regions/" + region + "/subnetworks/" + n.Subnet
+		}
+
+		if n.ExternalIP {
+			ni.AccessConfigs = []*compute.AccessConfig{
+				{
+					Type: "ONE_TO_ONE_NAT",
+					Name: "External NAT",
+				},
+			}
+		}
+
+		r = append(r, ni)
+	}
+
+	return r
+}
@@ -0,0 +1,170 @@
+package goeve
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/amb1s1/go-eve/eveapi"
+)
+
+// Node actions.
+const (
+	nodeStart  = "start"
+	nodeStop   = "stop"
+	nodeWipe   = "wipe"
+	nodeDelete = "delete"
+)
+
+// NodeResult reports a node action.
+type NodeResult struct {
+	ID     int
+	Name   string
+	Action string
+	Error  string `json:",omitempty"`
+}
+
+// selectNodes returns the nodes named, or with the id, in names. Without
+// names, start and stop select all the nodes, wipe and delete only with all.
+func selectNodes(nodes []eveapi.Node, action string, names []string, all bool) ([]eveapi.Node, error) {
+	if all && len(names) > 0 {
+		return nil, fmt.Errorf("node %v takes either node names or all the nodes", action)
+	}
+
+	if len(names) == 0 {
+		if all || action == nodeStart || action == nodeStop {
+			return nodes, nil
+		}
+
+		return nil, fmt.Errorf("node %v needs node names, or all the nodes explicitly", action)
+	}
+
+	var selected []eveapi.Node
+	for _, name := range names {
+		found := false
+		for _, n := range nodes {
+			if n.Name == name || strconv.Itoa(n.ID) == name {
+				selected = append(selected, n)
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("no node %q in the lab", name)
+		}
+	}
+
+	return selected, nil
+}
+
+// nodeAction runs action on the nodes in parallel, and returns their results
+// in the nodes order.
+func nodeAction(api *eveapi.Client, lab, action string, nodes []eveapi.Node) ([]NodeResult, error) {
+	var f func(string, int) error
+	switch action {
+	case nodeStart:
+		f = api.StartNode
+	case nodeStop:
+		f = api.StopNode
+	case nodeWipe:
+		f = api.WipeNode
+	case nodeDelete:
+		f = api.DeleteNode
+	default:
+		return nil, fmt.Errorf("unknown node action %q", action)
+	}
+
+	results := make([]NodeResult, len(nodes))
+
+	var wg sync.WaitGroup
+	for i, n := range nodes {
+		results[i] = NodeResult{ID: n.ID, Name: n.Name, Action: action}
+
+		wg.Add(1)
+		go func(r *NodeResult) {
+			defer wg.Done()
+
+			if err := f(lab, r.ID); err != nil {
+				r.Error = err.Error()
+			}
+		}(&results[i])
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, r := range results {
+		if r.Error != "" {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return results, fmt.Errorf("could not %v %d of %d nodes", action, failed, len(results))
+	}
+
+	return results, nil
+}
+
+// ListNodes returns the nodes of the eve-ng lab.
+func ListNodes(instanceName, configFile, lab string) ([]eveapi.Node, error) {
+	a, err := newAPISession(instanceName, configFile)
+	if err != nil {
+		return nil, err
+	}
+	defer a.close()
+
+	return a.api.Nodes(cleanPath(lab))
+}
+
+// AddNode adds the node n to the eve-ng lab, and returns it with its id.
+func AddNode(instanceName, configFile, lab string, n eveapi.Node) (*eveapi.Node, error) {
+	a, err := newAPISession(instanceName, configFile)
+	if err != nil {
+		return nil, err
+	}
+	defer a.close()
+
+	id, err := a.api.AddNode(cleanPath(lab), n)
+	if err != nil {
+		return nil, fmt.Errorf("could not add node %v, error: %v", n.Name, err)
+	}
+
+	nodes, err := a.api.Nodes(cleanPath(lab))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, n := range nodes {
+		if n.ID == id {
+			return &n, nil
+		}
+	}
+
+	return nil, fmt.Errorf("node %d was added but is not in the lab", id)
+}
+
+// NodeAction starts, stops, wipes or deletes the named nodes of the eve-ng lab,
+// or all its nodes with all, in parallel. Start and stop act on all the nodes
+// when names is empty.
+func NodeAction(instanceName, configFile, lab, action string, names []string, all bool) ([]NodeResult, error) {
+	a, err := newAPISession(instanceName, configFile)
+	if err != nil {
+		return nil, err
+	}
+	defer a.close()
+
+	lab = cleanPath(lab)
+
+	nodes, err := a.api.Nodes(lab)
+	if err != nil {
+		return nil, err
+	}
+
+	selected, err := selectNodes(nodes, action, names, all)
+	if err != nil {
+		return nil, err
+	}
+
+	return nodeAction(a.api, lab, action, selected)
+}
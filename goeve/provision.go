@@ -0,0 +1,417 @@
+package goeve
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amb1s1/go-eve/connect"
+)
+
+// Provisioning step types.
+const (
+	stepUpload           = "upload"
+	stepRun              = "run"
+	stepReboot           = "reboot"
+	stepAssertFileExists = "assertFileExists"
+	stepWaitForPort      = "waitForPort"
+)
+
+var (
+	// defaultSteps installs and sets up eve-ng. It is used when the config
+	// does not define its own provisioning steps.
+	defaultSteps = []step{
+		{Name: "upload install.sh", Type: stepUpload, Script: "install.sh"},
+		{Name: "run install.sh", Type: stepRun, Script: "install.sh", Timeout: 45 * time.Minute},
+		{Name: "reboot after install", Type: stepReboot},
+		{Name: "upload eve-initial-setup.sh", Type: stepUpload, Script: "eve-initial-setup.sh"},
+		{Name: "run eve-initial-setup.sh", Type: stepRun, Script: "eve-initial-setup.sh", Timeout: 15 * time.Minute},
+		{Name: "reboot after setup", Type: stepReboot},
+		{Name: "wait for the eve-ng web ui", Type: stepWaitForPort, Port: 80, Timeout: 5 * time.Minute},
+		{Name: "upload eve-admin-password.sh", Type: stepUpload, Script: "eve-admin-password.sh"},
+		{Name: "run eve-admin-password.sh", Type: stepRun, Script: "eve-admin-password.sh", Retries: 2},
+	}
+
+	// defaultStepTimeout applies to the steps without a timeout.
+	defaultStepTimeout = 10 * time.Minute
+	// defaultRetryDelay applies to the steps without a retry delay.
+	defaultRetryDelay = 10 * time.Second
+	// portPollInterval is how often a waitForPort step tries to connect.
+	portPollInterval = 5 * time.Second
+
+	// markerFile records, on the compute instance, the provisioning steps which completed.
+	markerFile = "/opt/go-eve/provisioned"
+	// legacyMarker marks instances provisioned before markerFile existed.
+	legacyMarker = "/opt/ovf/.configured"
+
+	errAlreadyConfigured = errors.New("VM is already configured")
+)
+
+// step is a provisioning step run on the compute instance.
+type step struct {
+	Name string `yaml:"name"`
+	// Type is one of upload, run, reboot, assertFileExists and waitForPort.
+	Type string `yaml:"type"`
+	// Script is the script uploaded or run by upload and run steps.
+	Script string `yaml:"script"`
+	// Path is the remote file checked by assertFileExists steps.
+	Path string `yaml:"path"`
+	// Port is the port, on the compute instance, waited for by waitForPort steps.
+	Port int `yaml:"port"`
+	// Version is bumped to run the step again on instances which completed it.
+	Version string `yaml:"version"`
+	// Timeout limits every attempt of the step.
+	Timeout time.Duration `yaml:"timeout"`
+	// Retries is the number of times the step is retried after a failure.
+	Retries    int           `yaml:"retries"`
+	RetryDelay time.Duration `yaml:"retryDelay"`
+}
+
+func (st step) timeout() time.Duration {
+	if st.Timeout > 0 {
+		return st.Timeout
+	}
+
+	return defaultStepTimeout
+}
+
+func (st step) retryDelay() time.Duration {
+	if st.RetryDelay > 0 {
+		return st.RetryDelay
+	}
+
+	return defaultRetryDelay
+}
+
+// validateSteps verifies every step has a known type and the fields its type needs.
+func validateSteps(steps []step) error {
+	for i, st := range steps {
+		if st.Name == "" {
+			return fmt.Errorf("provisioning step %d has no name", i)
+		}
+
+		switch st.Type {
+		case stepUpload, stepRun:
+			if st.Script == "" {
+				return fmt.Errorf("provisioning step %q has no script", st.Name)
+			}
+		case stepAssertFileExists:
+			if st.Path == "" {
+				return fmt.Errorf("provisioning step %q has no path", st.Name)
+			}
+		case stepWaitForPort:
+			if st.Port < 1 || st.Port > 65535 {
+				return fmt.Errorf("provisioning step %q has an invalid port %d", st.Name, st.Port)
+			}
+		case stepReboot:
+		default:
+			return fmt.Errorf("provisioning step %q has an unknown type %q", st.Name, st.Type)
+		}
+
+		if st.Retries < 0 {
+			return fmt.Errorf("provisioning step %q has negative retries", st.Name)
+		}
+	}
+
+	return nil
+}
+
+// steps returns the provisioning steps from the config, or the default ones,
+// which install the license of the pro edition.
+func (c *client) steps() []step {
+	if len(c.Provisioning) > 0 {
+		return c.Provisioning
+	}
+
+	if c.EveSetup.Edition == editionPro {
+		return append(append([]step{}, defaultSteps...), proSteps...)
+	}
+
+	return defaultSteps
+}
+
+// marker returns the line recording the completion of the step, made of its
+// name, version and the checksum of its script.
+func (c *client) marker(st step) (string, error) {
+	sum := ""
+	if st.Script != "" {
+		script, err := c.script(st.Script)
+		if err != nil {
+			return "", err
+		}
+
+		sum = fmt.Sprintf("%x", sha256.Sum256(script))
+	}
+
+	return strings.Join([]string{st.Name, st.Version, sum}, "\t"), nil
+}
+
+// readMarkers returns the completion markers recorded on the compute instance,
+// and whether the marker file exists.
+func readMarkers(sc connect.Functions) ([]string, bool, error) {
+	out, err := sc.Run("sudo cat " + markerFile + " 2> /dev/null || echo missing")
+	if err != nil {
+		return nil, false, err
+	}
+
+	if string(out) == "missing\n" {
+		return nil, false, nil
+	}
+
+	return strings.Split(strings.TrimSuffix(string(out), "\n"), "\n"), true, nil
+}
+
+// writeMarkers replaces the completion markers recorded on the compute instance.
+func writeMarkers(sc connect.Functions, markers []string) error {
+	content := ""
+	for _, m := range markers {
+		content += m + "\n"
+	}
+
+	cmd := fmt.Sprintf("sudo mkdir -p %v && printf %%s %v | sudo tee %v > /dev/null", path.Dir(markerFile), connect.ShellQuote(content), markerFile)
+	if out, err := sc.Run(cmd); err != nil {
+		return fmt.Errorf("could not write the provisioning markers, error: %v, output: %s", err, out)
+	}
+
+	return nil
+}
+
+// firstIncomplete returns the index of the first step whose marker is not in done.
+// Once a step runs, all the steps after it run too.
+func firstIncomplete(want, done []string) int {
+	for i, m := range want {
+		if i >= len(done) || done[i] != m {
+			return i
+		}
+	}
+
+	return len(want)
+}
+
+// provision runs the provisioning steps on the compute instance, in order.
+// It resumes at the first step which did not complete, or whose version or
+// script changed since it completed. A failed step is retried according to
+// its retry policy, and stops the provisioning. It returns the client to use
+// after provisioning, which changes when a step reboots the compute instance.
+func (c *client) provision(sc connect.Functions) (connect.Functions, error) {
+	steps := c.steps()
+
+	markers := make([]string, len(steps))
+	for i, st := range steps {
+		m, err := c.marker(st)
+		if err != nil {
+			return sc, err
+		}
+
+		markers[i] = m
+	}
+
+	done, found, err := readMarkers(sc)
+	if err != nil {
+		return sc, err
+	}
+
+	if !found {
+		if _, err := sc.Run("test -e " + legacyMarker); err == nil {
+			log.Printf("Instance was provisioned before %v existed, skipping provisioning", markerFile)
+			return sc, errAlreadyConfigured
+		}
+	}
+
+	first := firstIncomplete(markers, done)
+	if first == len(steps) {
+		return sc, errAlreadyConfigured
+	}
+
+	if first > 0 {
+		log.Printf("Resuming provisioning at step %q", steps[first].Name)
+	}
+
+	if err := writeMarkers(sc, markers[:first]); err != nil {
+		return sc, err
+	}
+
+	for i, st := range steps[first:] {
+		log.Printf("Provisioning step %q", st.Name)
+
+		for attempt := 0; ; attempt++ {
+			next, err := c.runStep(sc, st)
+			if next != nil {
+				sc = next
+			}
+
+			if err == nil {
+				break
+			}
+
+			if attempt >= st.Retries {
+				if st.Type == stepRun {
+					if err := removeScript(sc, steps, first+i, markers, true); err != nil {
+						log.Printf("Could not remove script %v, error: %v", st.Script, err)
+					}
+				}
+
+				return sc, fmt.Errorf("provisioning step %q failed, error: %w", st.Name, err)
+			}
+
+			log.Printf("Provisioning step %q failed, retrying in %v, error: %v", st.Name, st.retryDelay(), err)
+			time.Sleep(st.retryDelay())
+		}
+
+		// A script may regenerate the host keys, e.g. eve-initial-setup.sh,
+		// the next reboot only trusts them once pinned.
+		if st.Type == stepRun {
+			if err := sc.PinHostKeys(c.knownHostsFile()); err != nil {
+				return sc, fmt.Errorf("provisioning step %q failed, error: %w", st.Name, err)
+			}
+
+			if err := removeScript(sc, steps, first+i, markers, false); err != nil {
+				return sc, fmt.Errorf("provisioning step %q failed, error: %w", st.Name, err)
+			}
+		}
+
+		if err := writeMarkers(sc, markers[:first+i+1]); err != nil {
+			return sc, err
+		}
+	}
+
+	return sc, nil
+}
+
+// removeScript removes the script uploaded for the run step n once it ran, as
+// it may hold secrets, unless a later step runs it again. Scripts no step
+// uploaded are kept. When the step failed, the markers are rewound to the
+// upload of the script, so a rerun uploads it again.
+func removeScript(sc connect.Functions, steps []step, n int, markers []string, failed bool) error {
+	st := steps[n]
+
+	upload := -1
+	for i := n - 1; i >= 0 && upload < 0; i-- {
+		if steps[i].Type == stepUpload && steps[i].Script == st.Script {
+			upload = i
+		}
+	}
+
+	if upload < 0 {
+		return nil
+	}
+
+	if !failed {
+		for _, later := range steps[n+1:] {
+			if later.Script != st.Script {
+				continue
+			}
+
+			if later.Type == stepRun {
+				return nil
+			}
+
+			break
+		}
+	}
+
+	if out, err := sc.Run("rm -f ./" + connect.ShellQuote(st.Script)); err != nil {
+		return fmt.Errorf("could not remove script %v, error: %v, output: %s", st.Script, err, out)
+	}
+
+	if failed {
+		return writeMarkers(sc, markers[:upload])
+	}
+
+	return nil
+}
+
+// runStep runs a single attempt of the step. It returns the client to use for
+// the next steps, which changes when the step reboots the compute instance.
+func (c *client) runStep(sc connect.Functions, st step) (connect.Functions, error) {
+	switch st.Type {
+	case stepUpload:
+		script, err := c.script(st.Script)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, withTimeout(st.timeout(), func(ctx context.Context) error {
+			return sc.UploadContext(ctx, st.Script, script)
+		})
+	case stepRun:
+		if out, err := sc.RunScript(st.Script, st.timeout()); err != nil {
+			return nil, fmt.Errorf("%v, output: %s", err, out)
+		}
+
+		return nil, nil
+	case stepReboot:
+		return sc.RebootAndWait(st.timeout())
+	case stepAssertFileExists:
+		return nil, withTimeout(st.timeout(), func(ctx context.Context) error {
+			if _, err := sc.RunContext(ctx, "test -e "+connect.ShellQuote(st.Path)); err != nil {
+				if ctx.Err() != nil {
+					return err
+				}
+
+				return fmt.Errorf("file %v does not exist", st.Path)
+			}
+
+			return nil
+		})
+	case stepWaitForPort:
+		return nil, waitForPort(sc, st.Port, st.timeout())
+	}
+
+	return nil, fmt.Errorf("unknown provisioning step type %q", st.Type)
+}
+
+// waitForPort waits until port accepts connections on the compute instance.
+func waitForPort(sc connect.Functions, port int, timeout time.Duration) error {
+	addr := "127.0.0.1:" + strconv.Itoa(port)
+
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := sc.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			log.Printf("Port %d is open", port)
+
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("port %d did not open within %v, error: %v", port, timeout, err)
+		}
+
+		time.Sleep(portPollInterval)
+	}
+}
+
+// withTimeout runs f with a context cancelled after timeout. f must return
+// once the context is done, nothing of it keeps running after withTimeout.
+func withTimeout(timeout time.Duration, f func(context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := f(ctx); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("timed out after %v", timeout)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// describeSteps returns the step names, for logging.
+func describeSteps(steps []step) string {
+	var names []string
+	for _, st := range steps {
+		names = append(names, st.Name)
+	}
+
+	return strings.Join(names, ", ")
+}
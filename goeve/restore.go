@@ -0,0 +1,157 @@
+package goeve
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+
+	"github.com/amb1s1/go-eve/eveapi"
+	"gopkg.in/yaml.v2"
+)
+
+// NodeRestore reports the configuration restore of a node.
+type NodeRestore struct {
+	Name  string
+	File  string
+	Error string `json:",omitempty"`
+}
+
+// RestoreResult reports the configuration restore of an eve-ng lab.
+type RestoreResult struct {
+	Lab     string
+	Nodes   []NodeRestore
+	Started []NodeResult `json:",omitempty"`
+}
+
+// loadMapping reads the mapping file of the saved node names to the lab node
+// names, an empty file name means no mapping.
+func loadMapping(file string) (map[string]string, error) {
+	m := map[string]string{}
+	if file == "" {
+		return m, nil
+	}
+
+	f, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read mapping file %v, error: %v", file, err)
+	}
+
+	if err := yaml.UnmarshalStrict(f, &m); err != nil {
+		return nil, fmt.Errorf("could not parse mapping file %v, error: %v", file, err)
+	}
+
+	return m, nil
+}
+
+// matchConfigs matches the saved <node>.cfg files to the lab nodes, renamed by
+// the mapping. Files without a stopped lab node are reported with an error.
+func matchConfigs(files []string, nodes []eveapi.Node, mapping map[string]string) ([]NodeRestore, map[string]eveapi.Node) {
+	byName := map[string]eveapi.Node{}
+	for _, n := range nodes {
+		byName[n.Name] = n
+	}
+
+	sort.Strings(files)
+
+	var restores []NodeRestore
+	matched := map[string]eveapi.Node{}
+	for _, f := range files {
+		name := fileNode(f)
+		if m, ok := mapping[name]; ok {
+			name = m
+		}
+
+		r := NodeRestore{Name: name, File: f}
+
+		n, ok := byName[name]
+		switch {
+		case !ok:
+			r.Error = "no node " + name + " in the lab"
+		case n.Status != eveapi.NodeStopped:
+			r.Error = "node is running, stop it before restoring its configuration"
+		default:
+			matched[f] = n
+		}
+
+		restores = append(restores, r)
+	}
+
+	return restores, matched
+}
+
+// Restore sets the configurations saved in dir, as <node>.cfg files, as the
+// startup configurations of the stopped nodes of the eve-ng lab. The mapping
+// file renames the saved nodes to the lab ones. With start, the restored
+// nodes are started.
+func Restore(instanceName, configFile, lab, dir, mappingFile string, start bool) (*RestoreResult, error) {
+	mapping, err := loadMapping(mappingFile)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.cfg"))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no node configurations found in %v", dir)
+	}
+
+	a, err := newAPISession(instanceName, configFile)
+	if err != nil {
+		return nil, err
+	}
+	defer a.close()
+
+	lab = cleanPath(lab)
+
+	nodes, err := a.api.Nodes(lab)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &RestoreResult{Lab: lab}
+
+	var restored []eveapi.Node
+	restores, matched := matchConfigs(files, nodes, mapping)
+	for _, nr := range restores {
+		n, ok := matched[nr.File]
+		if ok {
+			if err := restoreNode(a.api, lab, n, nr.File); err != nil {
+				nr.Error = err.Error()
+			} else {
+				restored = append(restored, n)
+			}
+		}
+
+		r.Nodes = append(r.Nodes, nr)
+	}
+
+	if start && len(restored) > 0 {
+		if r.Started, err = nodeAction(a.api, lab, nodeStart, restored); err != nil {
+			return r, err
+		}
+	}
+
+	if len(restored) < len(restores) {
+		return r, fmt.Errorf("could not restore %d of %d node configurations", len(restores)-len(restored), len(restores))
+	}
+
+	return r, nil
+}
+
+// restoreNode sets the saved configuration file as the startup configuration of the node.
+func restoreNode(api *eveapi.Client, lab string, n eveapi.Node, file string) error {
+	config, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	if err := api.SetConfig(lab, n.ID, string(config)); err != nil {
+		return err
+	}
+
+	return api.UseConfig(lab, n.ID, true)
+}
@@ -0,0 +1,179 @@
+package goeve
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/amb1s1/go-eve/connect"
+	"github.com/amb1s1/go-eve/scripts"
+)
+
+// eveSetup holds the eve-ng host settings rendered into the provisioning scripts.
+type eveSetup struct {
+	// Edition is community or pro. Pro needs the LicenseFile, installed on the
+	// host at LicensePath.
+	Edition     string `yaml:"edition"`
+	LicenseFile string `yaml:"licenseFile"`
+	LicensePath string `yaml:"licensePath"`
+	// License is the base64 content of LicenseFile.
+	License string `yaml:"-"`
+	// EveVersion pins the version of the eve-ng package, e.g. 2.0.3-112.
+	EveVersion string `yaml:"eveVersion"`
+	Hostname   string `yaml:"hostname"`
+	Domain     string `yaml:"domain"`
+	// RootPassword and AdminPassword, the eve-ng web admin password, are
+	// generated per lab when not set.
+	RootPassword  string `yaml:"rootPassword"`
+	AdminPassword string `yaml:"adminPassword"`
+	// Network is dhcp or static. IP, Netmask and Gateway only apply to static.
+	Network string   `yaml:"network"`
+	IP      string   `yaml:"ip"`
+	Netmask string   `yaml:"netmask"`
+	Gateway string   `yaml:"gateway"`
+	DNS     []string `yaml:"dns"`
+	NTP     []string `yaml:"ntp"`
+	Proxy   proxy    `yaml:"proxy"`
+	// CloudBridges are the pnet bridges, set from the networkInterfaces config.
+	CloudBridges []cloudBridge `yaml:"-"`
+	// secretsOnInstance renders the secrets as reads of the files the
+	// startup-script writes into secretsDir, to keep them out of the scripts.
+	secretsOnInstance bool
+}
+
+// proxy is the proxy apt goes through on the eve-ng host.
+type proxy struct {
+	// Type is direct, anonymous or authenticated.
+	Type     string `yaml:"type"`
+	URL      string `yaml:"url"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// secrets are the secret settings of the scripts, by name.
+func (e eveSetup) secrets() map[string]string {
+	return map[string]string{
+		"root_password":  e.RootPassword,
+		"admin_password": e.AdminPassword,
+		"proxy_password": e.Proxy.Password,
+		"license":        e.License,
+	}
+}
+
+// Secret returns the secret setting name quoted for the shell, or the shell
+// reading it from secretsDir on the compute instance.
+func (e eveSetup) Secret(name string) (string, error) {
+	v, ok := e.secrets()[name]
+	if !ok {
+		return "", fmt.Errorf("unknown secret %q", name)
+	}
+
+	if e.secretsOnInstance {
+		return fmt.Sprintf(`"$(cat %v)"`, path.Join(secretsDir, name)), nil
+	}
+
+	return connect.ShellQuote(v), nil
+}
+
+// ScriptType returns the proxy type as eve-initial-setup.sh names it.
+func (p proxy) ScriptType() string {
+	switch p.Type {
+	case "anonymous":
+		return "anonymous proxy"
+	case "authenticated":
+		return "authenticated proxy"
+	}
+
+	return "direct connection"
+}
+
+// Package returns the eve-ng package of the edition.
+func (e eveSetup) Package() string {
+	if e.Edition == editionPro {
+		return "eve-ng-pro"
+	}
+
+	return "eve-ng"
+}
+
+// setDefaults fills the settings missing from the config with the eve-ng defaults.
+func (e *eveSetup) setDefaults() {
+	if e.Edition == "" {
+		e.Edition = editionCommunity
+	}
+
+	if e.LicensePath == "" {
+		e.LicensePath = defaultLicensePath
+	}
+
+	if e.Hostname == "" {
+		e.Hostname = "eve-ng"
+	}
+
+	if e.Domain == "" {
+		e.Domain = "example"
+	}
+
+	if e.Network == "" {
+		e.Network = "dhcp"
+	}
+
+	if len(e.DNS) == 0 {
+		// The google cloud metadata server resolves both internal and external names.
+		e.DNS = []string{"169.254.169.254"}
+	}
+
+	if e.Proxy.Type == "" {
+		e.Proxy.Type = "direct"
+	}
+}
+
+// validate verifies the settings are consistent.
+func (e *eveSetup) validate() error {
+	switch e.Edition {
+	case editionCommunity:
+	case editionPro:
+		if e.LicenseFile == "" {
+			return errors.New("eveSetup: the pro edition needs a licenseFile")
+		}
+	default:
+		return errors.New("eveSetup: edition must be community or pro")
+	}
+
+	switch e.Network {
+	case "dhcp":
+	case "static":
+		if e.IP == "" || e.Netmask == "" || e.Gateway == "" {
+			return errors.New("eveSetup: a static network needs an ip, a netmask and a gateway")
+		}
+	default:
+		return errors.New("eveSetup: network must be dhcp or static")
+	}
+
+	switch e.Proxy.Type {
+	case "direct":
+	case "anonymous", "authenticated":
+		if e.Proxy.URL == "" {
+			return errors.New("eveSetup: a proxy needs an url")
+		}
+	default:
+		return errors.New("eveSetup: proxy type must be direct, anonymous or authenticated")
+	}
+
+	if e.Proxy.Type == "authenticated" && e.Proxy.Username == "" {
+		return errors.New("eveSetup: an authenticated proxy needs a username")
+	}
+
+	if strings.ContainsAny(e.AdminPassword, `"\`) {
+		return errors.New(`eveSetup: adminPassword cannot contain " or \`)
+	}
+
+	return nil
+}
+
+// script returns the provisioning script name, rendered with the config. Local
+// scripts are only rendered with templateScripts.
+func (c *client) script(name string) ([]byte, error) {
+	return scripts.Render(name, c.Scripts[name], c.TemplateScripts, c.EveSetup)
+}
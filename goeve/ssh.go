@@ -0,0 +1,25 @@
+package goeve
+
+import (
+	evecompute "github.com/amb1s1/go-eve/eve-compute"
+)
+
+// SSH opens an interactive ssh session into the eve-ng compute instance.
+func SSH(instanceName, configFile string) error {
+	c, err := new(instanceName, configFile, false)
+	if err != nil {
+		return err
+	}
+
+	service, err := evecompute.New()
+	if err != nil {
+		return err
+	}
+
+	sc, err := c.sshClient(service)
+	if err != nil {
+		return err
+	}
+
+	return sc.Shell()
+}
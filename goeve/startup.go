@@ -0,0 +1,354 @@
+package goeve
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"sort"
+	"text/template"
+	"time"
+
+	"github.com/amb1s1/go-eve/connect"
+	evecompute "github.com/amb1s1/go-eve/eve-compute"
+)
+
+// Provisioning modes.
+const (
+	// modeSSH provisions the compute instance over ssh from the operator machine.
+	modeSSH = "ssh"
+	// modeStartupScript provisions the compute instance with its startup-script
+	// metadata, go-eve only follows the progress through guest attributes.
+	modeStartupScript = "startupScript"
+)
+
+var (
+	// secretsDir is where the startup-script writes the secrets, for the
+	// provisioning scripts to read them.
+	secretsDir = "/opt/go-eve/secrets"
+	// secretsMetadataKey is the instance metadata key passing the secrets to
+	// the startup-script, which removes it once it read them.
+	secretsMetadataKey = "go-eve-secrets"
+	// startupScriptTimeout is how long go-eve follows the startup-script provisioning.
+	startupScriptTimeout = 90 * time.Minute
+	// guestAttributesPollInterval is how often the startup-script progress is checked.
+	guestAttributesPollInterval = 15 * time.Second
+)
+
+// startupScriptTemplate runs the provisioning steps at every boot, resuming at
+// the first incomplete step with the same markers as the ssh mode. It reports
+// its progress in the go-eve guest attributes namespace and on the serial port.
+// It holds no secret: when the scripts need some, it reads them from the
+// secretsMetadataKey metadata into secretsDir and removes that key, and
+// removes secretsDir once provisioning is done. It then publishes the host
+// keys, which eve-initial-setup.sh regenerates, for go-eve to pin them.
+var startupScriptTemplate = template.Must(template.New("startup-script").Parse(`#!/bin/bash
+# Generated by go-eve, provisions the eve-ng compute instance at boot.
+MARKERS={{.MarkerFile}}
+SCRIPTS=/opt/go-eve/scripts
+SECRETS={{.SecretsDir}}
+
+report() {
+    echo "go-eve: $1=$2"
+    curl -s -X PUT --data "$2" -H "Metadata-Flavor: Google" \
+        "http://metadata.google.internal/computeMetadata/v1/instance/guest-attributes/go-eve/$1" > /dev/null
+}
+
+# step_done <n> <marker> succeeds when step n completed with marker.
+step_done() {
+    [ "$(sed -n "$1p" "$MARKERS" 2> /dev/null)" = "$2" ]
+}
+
+# complete_step <n> <marker> records step n completed, forgetting the steps after it.
+complete_step() {
+    head -n "$(($1 - 1))" "$MARKERS" > "$MARKERS.tmp" 2> /dev/null
+    printf '%s\n' "$2" >> "$MARKERS.tmp"
+    mv "$MARKERS.tmp" "$MARKERS"
+}
+
+# attempt <retries> <delay> <command...> runs command until it succeeds, at most retries+1 times.
+attempt() {
+    local retries=$1 delay=$2
+    shift 2
+    for i in $(seq 0 "$retries"); do
+        "$@" && return 0
+        [ "$i" -lt "$retries" ] && sleep "$delay"
+    done
+    return 1
+}
+
+# fetch_secrets writes the secrets of the go-eve metadata key into $SECRETS,
+# readable by root only, then removes the key from the instance metadata.
+fetch_secrets() {
+    [ -n "$fetched" ] && return
+    if [ ! -e "$SECRETS/.done" ]; then
+        local secrets
+        secrets=$(curl -sf -H "Metadata-Flavor: Google" \
+            "http://metadata.google.internal/computeMetadata/v1/instance/attributes/"{{.SecretsKey}}) || return 1
+        (
+            umask 077
+            mkdir -p "$SECRETS"
+            while read -r name value; do
+                [ -n "$name" ] || continue
+                printf %s "$value" | base64 -d > "$SECRETS/$name" || exit 1
+            done <<< "$secrets"
+            touch "$SECRETS/.done"
+        ) || return 1
+    fi
+    drop_secrets_metadata && fetched=1
+}
+
+# drop_secrets_metadata removes the go-eve secrets key from the instance
+# metadata, with the compute api and the instance service account.
+drop_secrets_metadata() {
+    python3 - {{.SecretsKey}} << 'GOEVE_EOF'
+import json, sys, urllib.request
+
+def call(url, headers, data=None):
+    req = urllib.request.Request(url, data=data, headers=headers, method="POST" if data else "GET")
+    with urllib.request.urlopen(req) as r:
+        return r.read().decode()
+
+md = "http://metadata.google.internal/computeMetadata/v1/"
+flavor = {"Metadata-Flavor": "Google"}
+token = json.loads(call(md + "instance/service-accounts/default/token", flavor))["access_token"]
+zone = call(md + "instance/zone", flavor).split("/")[-1]
+url = "https://compute.googleapis.com/compute/v1/projects/%s/zones/%s/instances/%s" % (
+    call(md + "project/project-id", flavor), zone, call(md + "instance/name", flavor))
+auth = {"Authorization": "Bearer " + token, "Content-Type": "application/json"}
+
+metadata = json.loads(call(url, auth))["metadata"]
+items = [i for i in metadata.get("items", []) if i["key"] != sys.argv[1]]
+if len(items) != len(metadata.get("items", [])):
+    metadata["items"] = items
+    call(url + "/setMetadata", auth, json.dumps(metadata).encode())
+GOEVE_EOF
+}
+
+fail() {
+    report error "provisioning step $1 failed"
+    report status failed
+    exit 1
+}
+
+mkdir -p "$(dirname "$MARKERS")" "$SCRIPTS"
+fetched=
+
+if [ ! -e "$MARKERS" ] && [ -e {{.LegacyMarker}} ]; then
+    report status done
+    exit 0
+fi
+
+report status running
+resume=1
+{{range .Steps}}
+if [ $resume = 1 ] && step_done {{.N}} {{.Marker}}; then
+    echo "go-eve: skipping completed step "{{.Name}}
+else
+    resume=0
+    report step {{.Name}}
+{{- if $.Secrets}}
+    fetch_secrets || fail {{.Name}}
+{{- end}}
+{{- if .Content}}
+    base64 -d > "$SCRIPTS/"{{.Script}} << 'GOEVE_EOF' || fail {{.Name}}
+{{.Content}}
+GOEVE_EOF
+{{- else}}
+    {{.Command}} || fail {{.Name}}
+{{- end}}
+    complete_step {{.N}} {{.Marker}}
+{{- if .Reboot}}
+    reboot
+    exit 0
+{{- end}}
+fi
+{{end}}
+rm -rf "$SECRETS"
+report hostkeys "$(cat /etc/ssh/ssh_host_*_key.pub)"
+report status done
+`))
+
+// startupStep is a provisioning step rendered in the startup script, all its
+// strings are quoted for the shell.
+type startupStep struct {
+	N       int
+	Name    string
+	Marker  string
+	Script  string
+	Content string
+	Command string
+	Reboot  bool
+}
+
+// startupScript returns the startup script running the provisioning steps.
+func (c *client) startupScript() (string, error) {
+	data := struct {
+		MarkerFile   string
+		LegacyMarker string
+		SecretsDir   string
+		SecretsKey   string
+		Secrets      bool
+		Steps        []startupStep
+	}{
+		MarkerFile:   markerFile,
+		LegacyMarker: legacyMarker,
+		SecretsDir:   connect.ShellQuote(secretsDir),
+		SecretsKey:   connect.ShellQuote(secretsMetadataKey),
+	}
+
+	secrets, err := c.usesSecrets()
+	if err != nil {
+		return "", err
+	}
+	data.Secrets = secrets
+
+	for i, st := range c.steps() {
+		m, err := c.marker(st)
+		if err != nil {
+			return "", err
+		}
+
+		s := startupStep{
+			N:      i + 1,
+			Name:   connect.ShellQuote(st.Name),
+			Marker: connect.ShellQuote(m),
+			Script: connect.ShellQuote(st.Script),
+		}
+
+		retry := fmt.Sprintf("attempt %d %d", st.Retries, int(st.retryDelay().Seconds()))
+		timeout := int(st.timeout().Seconds())
+
+		switch st.Type {
+		case stepUpload:
+			script, err := c.script(st.Script)
+			if err != nil {
+				return "", err
+			}
+
+			s.Content = base64.StdEncoding.EncodeToString(script)
+		case stepRun:
+			s.Command = fmt.Sprintf(`%v timeout --kill-after=30 %d bash "$SCRIPTS/"%v`, retry, timeout, s.Script)
+		case stepReboot:
+			s.Command = "true"
+			s.Reboot = true
+		case stepAssertFileExists:
+			s.Command = fmt.Sprintf("%v test -e %v", retry, connect.ShellQuote(st.Path))
+		case stepWaitForPort:
+			s.Command = fmt.Sprintf(`%v timeout %d bash -c 'until echo 2> /dev/null > /dev/tcp/127.0.0.1/%d; do sleep 5; done'`, retry, timeout, st.Port)
+		}
+
+		data.Steps = append(data.Steps, s)
+	}
+
+	var b bytes.Buffer
+	if err := startupScriptTemplate.Execute(&b, data); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// usesSecrets reports whether the uploaded scripts read secrets from secretsDir.
+func (c *client) usesSecrets() (bool, error) {
+	for _, st := range c.steps() {
+		if st.Type != stepUpload {
+			continue
+		}
+
+		script, err := c.script(st.Script)
+		if err != nil {
+			return false, err
+		}
+
+		if bytes.Contains(script, []byte(secretsDir+"/")) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// secretsMetadata returns the value of the secretsMetadataKey metadata, a
+// "name base64(value)" line per secret, or "" when no script needs secrets.
+func (c *client) secretsMetadata() (string, error) {
+	secrets, err := c.usesSecrets()
+	if err != nil || !secrets {
+		return "", err
+	}
+
+	var names []string
+	for name := range c.EveSetup.secrets() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	v := ""
+	for _, name := range names {
+		v += name + " " + base64.StdEncoding.EncodeToString([]byte(c.EveSetup.secrets()[name])) + "\n"
+	}
+
+	return v, nil
+}
+
+// waitForStartupScript follows the startup-script provisioning through the
+// guest attributes of the compute instance, until it is done or failed.
+func (c *client) waitForStartupScript(s evecompute.ServiceFunctions) error {
+	log.Println("Following the startup-script provisioning")
+
+	step := ""
+	deadline := time.Now().Add(startupScriptTimeout)
+	for time.Now().Before(deadline) {
+		attrs, err := s.GuestAttributes(c.ProjectID, c.Zone, c.InstanceName, "go-eve/")
+		if err != nil {
+			log.Printf("No provisioning progress yet: %v", err)
+		}
+
+		if attrs["step"] != step {
+			step = attrs["step"]
+			log.Printf("Provisioning step %q", step)
+		}
+
+		switch attrs["status"] {
+		case "done":
+			c.Status.Settings = "configured"
+			return c.pinHostKeys(s, attrs["hostkeys"])
+		case "failed":
+			return fmt.Errorf("startup-script provisioning failed: %v", attrs["error"])
+		}
+
+		time.Sleep(guestAttributesPollInterval)
+	}
+
+	return fmt.Errorf("startup-script provisioning did not finish within %v, it goes on on the instance, rerun go-eve to follow it", startupScriptTimeout)
+}
+
+// pinHostKeys pins the host keys the startup-script published, replacing the
+// ones pinned before provisioning regenerated them. Instances provisioned
+// before go-eve published them keep their pinned keys.
+func (c *client) pinHostKeys(s evecompute.ServiceFunctions, keys string) error {
+	if keys == "" {
+		return nil
+	}
+
+	ip, err := s.LookupExternalIP(c.ProjectID, c.Zone, c.InstanceName)
+	if err != nil {
+		return err
+	}
+
+	if err := connect.ReplaceHostKeys(c.knownHostsFile(), ip.String(), []byte(keys)); err != nil {
+		return fmt.Errorf("could not pin the host keys of %v, error: %v", c.InstanceName, err)
+	}
+
+	return nil
+}
+
+// validateMode verifies the provisioning mode is known.
+func validateMode(mode string) error {
+	switch mode {
+	case "", modeSSH, modeStartupScript:
+		return nil
+	}
+
+	return fmt.Errorf("unknown provisioning mode %q, want %v or %v", mode, modeSSH, modeStartupScript)
+}
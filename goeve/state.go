@@ -0,0 +1,66 @@
+package goeve
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// labState is the local state of a lab, kept in stateDir/labs/<lab>.json.
+// It holds secrets, so it is only readable by its owner.
+type labState struct {
+	RootPassword  string `json:"rootPassword"`
+	AdminPassword string `json:"adminPassword"`
+}
+
+func (c *client) stateFile() string {
+	return filepath.Join(c.StateDir, "labs", c.InstanceName+".json")
+}
+
+// loadState returns the local state of the lab, empty if the lab has none.
+func (c *client) loadState() (*labState, error) {
+	st := &labState{}
+
+	f, err := ioutil.ReadFile(c.stateFile())
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(f, st); err != nil {
+		return nil, err
+	}
+
+	return st, nil
+}
+
+// saveState writes the local state of the lab, with 0600 permissions.
+func (c *client) saveState(st *labState) error {
+	if err := os.MkdirAll(filepath.Dir(c.stateFile()), 0700); err != nil {
+		return err
+	}
+
+	f, err := json.MarshalIndent(st, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(c.stateFile(), f, 0600); err != nil {
+		return err
+	}
+
+	// WriteFile keeps the permissions of an existing file.
+	return os.Chmod(c.stateFile(), 0600)
+}
+
+// removeState deletes the local state of the lab.
+func (c *client) removeState() error {
+	if err := os.Remove(c.stateFile()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package goeve
+
+import (
+	"fmt"
+
+	"github.com/amb1s1/go-eve/connect"
+	evecompute "github.com/amb1s1/go-eve/eve-compute"
+)
+
+// Sync copies a file or directory recursively between the local machine and
+// the compute instance. direction is "push", local to remote, or "pull",
+// remote to local. Files which are already in sync are skipped. If sudo is
+// true, the remote files are written or read as root.
+func Sync(instanceName, configFile, direction, local, remote string, sudo bool) (*connect.SyncResult, error) {
+	if direction != "push" && direction != "pull" {
+		return nil, fmt.Errorf("unknown sync direction %q, want push or pull", direction)
+	}
+
+	c, err := new(instanceName, configFile, false)
+	if err != nil {
+		return nil, err
+	}
+
+	service, err := evecompute.New()
+	if err != nil {
+		return nil, err
+	}
+
+	sc, err := c.sshClient(service)
+	if err != nil {
+		return nil, err
+	}
+
+	if direction == "push" {
+		return sc.Push(local, remote, sudo)
+	}
+
+	return sc.Pull(remote, local, sudo)
+}
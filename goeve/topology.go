@@ -0,0 +1,622 @@
+package goeve
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/amb1s1/go-eve/eveapi"
+	"gopkg.in/yaml.v2"
+)
+
+// Topology change actions.
+const (
+	changeCreate     = "create"
+	changeUpdate     = "update"
+	changeReplace    = "replace"
+	changeDelete     = "delete"
+	changeConnect    = "connect"
+	changeDisconnect = "disconnect"
+)
+
+// p2pNetworkType is the type of the hidden networks of point-to-point links.
+const p2pNetworkType = "bridge"
+
+// topology is a declarative eve-ng lab.
+type topology struct {
+	// Lab is the eve-ng lab path, e.g. /team/ospf.unl.
+	Lab         string            `yaml:"lab"`
+	Author      string            `yaml:"author"`
+	Description string            `yaml:"description"`
+	Nodes       []topologyNode    `yaml:"nodes"`
+	Networks    []topologyNetwork `yaml:"networks"`
+	// Links connect two endpoints: a node interface, as node:interface, to
+	// another node interface or to a network name.
+	Links [][]string `yaml:"links"`
+}
+
+// topologyNode is a node. Only the set fields are compared to the lab node,
+// Left and Top only place new nodes.
+type topologyNode struct {
+	Name     string `yaml:"name"`
+	Template string `yaml:"template"`
+	Type     string `yaml:"type"`
+	Image    string `yaml:"image"`
+	Icon     string `yaml:"icon"`
+	CPU      int    `yaml:"cpu"`
+	RAM      int    `yaml:"ram"`
+	Ethernet int    `yaml:"ethernet"`
+	Left     int    `yaml:"left"`
+	Top      int    `yaml:"top"`
+}
+
+// topologyNetwork is a network, a bridge or an eve-ng pnet cloud.
+type topologyNetwork struct {
+	Name string `yaml:"name"`
+	Type string `yaml:"type"`
+	Left int    `yaml:"left"`
+	Top  int    `yaml:"top"`
+}
+
+// Change is a change applied to an eve-ng lab to match its topology.
+type Change struct {
+	Action string
+	// Kind is lab, node, network or link.
+	Kind   string
+	Name   string
+	Detail string `json:",omitempty"`
+}
+
+func (ch Change) String() string {
+	s := fmt.Sprintf("%v %v %v", ch.Action, ch.Kind, ch.Name)
+	if ch.Detail != "" {
+		s += " (" + ch.Detail + ")"
+	}
+
+	return s
+}
+
+// ApplyResult reports the plan of a topology apply, and whether it was applied.
+type ApplyResult struct {
+	Lab     string
+	Changes []Change
+	Applied bool
+}
+
+// Destructive reports whether the plan deletes or replaces nodes or networks,
+// or disconnects links.
+func (r *ApplyResult) Destructive() bool {
+	for _, ch := range r.Changes {
+		switch ch.Action {
+		case changeDelete, changeReplace, changeDisconnect:
+			return true
+		}
+	}
+
+	return false
+}
+
+// loadTopology reads and validates the topology file.
+func loadTopology(file string) (*topology, error) {
+	f, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read topology file %v, error: %v", file, err)
+	}
+
+	t := &topology{}
+	if err := yaml.UnmarshalStrict(f, t); err != nil {
+		return nil, fmt.Errorf("could not parse topology file %v, error: %v", file, err)
+	}
+
+	if err := t.validate(); err != nil {
+		return nil, fmt.Errorf("invalid topology file %v, error: %v", file, err)
+	}
+
+	t.Lab = cleanPath(t.Lab)
+
+	return t, nil
+}
+
+// validate verifies the names are unique and the links connect known nodes
+// and networks, every interface at most once.
+func (t *topology) validate() error {
+	if !isLab(t.Lab) {
+		return errors.New("lab must be an eve-ng lab path ending in .unl")
+	}
+
+	nodes := map[string]bool{}
+	for _, n := range t.Nodes {
+		if n.Name == "" || n.Template == "" {
+			return errors.New("every node needs a name and a template")
+		}
+
+		if nodes[n.Name] || strings.Contains(n.Name, ":") {
+			return fmt.Errorf("node name %q is duplicated or contains a colon", n.Name)
+		}
+		nodes[n.Name] = true
+	}
+
+	networks := map[string]bool{}
+	for _, n := range t.Networks {
+		if n.Name == "" || networks[n.Name] || nodes[n.Name] || strings.Contains(n.Name, ":") {
+			return fmt.Errorf("network name %q is empty, duplicated or contains a colon", n.Name)
+		}
+		networks[n.Name] = true
+	}
+
+	used := map[string]bool{}
+	for _, l := range t.Links {
+		if len(l) != 2 {
+			return fmt.Errorf("link %v must have two endpoints", l)
+		}
+
+		ifaces := 0
+		for _, e := range l {
+			node, _, ok := splitEndpoint(e)
+			switch {
+			case !ok && networks[e]:
+				continue
+			case !ok:
+				return fmt.Errorf("link %v: unknown network %q", l, e)
+			case !nodes[node]:
+				return fmt.Errorf("link %v: unknown node %q", l, node)
+			case used[e]:
+				return fmt.Errorf("link %v: interface %v is already linked", l, e)
+			}
+
+			used[e] = true
+			ifaces++
+		}
+
+		if ifaces == 0 {
+			return fmt.Errorf("link %v connects two networks", l)
+		}
+	}
+
+	return nil
+}
+
+// splitEndpoint splits the link endpoint node:interface.
+func splitEndpoint(e string) (string, string, bool) {
+	i := strings.Index(e, ":")
+	if i < 0 {
+		return "", "", false
+	}
+
+	return e[:i], e[i+1:], true
+}
+
+// desiredLinks returns the networks of the topology, with a hidden network for
+// every point-to-point link, and the network of every linked interface.
+func (t *topology) desiredLinks() ([]topologyNetwork, map[string]string) {
+	networks := append([]topologyNetwork{}, t.Networks...)
+	links := map[string]string{}
+
+	for _, l := range t.Links {
+		a, b := l[0], l[1]
+		_, _, aIface := splitEndpoint(a)
+		_, _, bIface := splitEndpoint(b)
+
+		switch {
+		case aIface && bIface:
+			ends := []string{a, b}
+			sort.Strings(ends)
+			name := strings.Join(ends, "--")
+
+			networks = append(networks, topologyNetwork{Name: name, Type: p2pNetworkType})
+			links[a], links[b] = name, name
+		case aIface:
+			links[a] = b
+		default:
+			links[b] = a
+		}
+	}
+
+	return networks, links
+}
+
+// labTopology is the current topology of an eve-ng lab.
+type labTopology struct {
+	nodes    map[string]eveapi.Node
+	networks map[string]eveapi.Network
+	// links are the network names of the connected interfaces, keyed by node:interface.
+	links map[string]string
+	// ifaces are the interfaces of the nodes, by node name.
+	ifaces map[string][]eveapi.Interface
+}
+
+// readLabTopology reads the current topology of the eve-ng lab. A missing lab
+// has an empty topology, exists tells it apart.
+func readLabTopology(api *eveapi.Client, lab string) (cur *labTopology, exists bool, err error) {
+	cur = &labTopology{
+		nodes:    map[string]eveapi.Node{},
+		networks: map[string]eveapi.Network{},
+		links:    map[string]string{},
+		ifaces:   map[string][]eveapi.Interface{},
+	}
+
+	if _, err := api.Lab(lab); err != nil {
+		var apiErr *eveapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == 404 {
+			return cur, false, nil
+		}
+
+		return nil, false, err
+	}
+
+	nodes, err := api.Nodes(lab)
+	if err != nil {
+		return nil, true, err
+	}
+
+	networks, err := api.Networks(lab)
+	if err != nil {
+		return nil, true, err
+	}
+
+	byID := map[int]string{}
+	for _, n := range networks {
+		cur.networks[n.Name] = n
+		byID[n.ID] = n.Name
+	}
+
+	for _, n := range nodes {
+		cur.nodes[n.Name] = n
+
+		ifaces, err := api.Interfaces(lab, n.ID)
+		if err != nil {
+			return nil, true, err
+		}
+
+		cur.ifaces[n.Name] = ifaces
+		for _, i := range ifaces {
+			if i.NetworkID != 0 {
+				cur.links[n.Name+":"+i.Name] = byID[i.NetworkID]
+			}
+		}
+	}
+
+	return cur, true, nil
+}
+
+// plan returns the changes making the current lab topology match t, in the
+// order they apply. Without prune, the nodes, networks and links missing from
+// t are kept.
+func plan(t *topology, cur *labTopology, exists, prune bool) []Change {
+	var changes []Change
+
+	if !exists {
+		changes = append(changes, Change{Action: changeCreate, Kind: "lab", Name: t.Lab})
+	}
+
+	// gone are the nodes and networks deleted or replaced, so their links are too.
+	gone := map[string]bool{}
+
+	want := map[string]bool{}
+	for _, n := range t.Nodes {
+		want[n.Name] = true
+
+		c, ok := cur.nodes[n.Name]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Action: changeCreate, Kind: "node", Name: n.Name, Detail: n.Template})
+		case c.Template != n.Template || (n.Type != "" && c.Type != n.Type):
+			changes = append(changes, Change{Action: changeReplace, Kind: "node", Name: n.Name, Detail: c.Template + " to " + n.Template})
+			gone[n.Name] = true
+		default:
+			if d := nodeDiff(n, c); d != "" {
+				changes = append(changes, Change{Action: changeUpdate, Kind: "node", Name: n.Name, Detail: d})
+			}
+		}
+	}
+
+	if prune {
+		for _, name := range nodeNames(cur.nodes) {
+			if !want[name] {
+				changes = append(changes, Change{Action: changeDelete, Kind: "node", Name: name})
+				gone[name] = true
+			}
+		}
+	}
+
+	networks, links := t.desiredLinks()
+
+	want = map[string]bool{}
+	for _, n := range networks {
+		want[n.Name] = true
+
+		typ := n.Type
+		if typ == "" {
+			typ = "bridge"
+		}
+
+		c, ok := cur.networks[n.Name]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Action: changeCreate, Kind: "network", Name: n.Name, Detail: typ})
+		case c.Type != typ:
+			changes = append(changes, Change{Action: changeReplace, Kind: "network", Name: n.Name, Detail: c.Type + " to " + typ})
+			gone[n.Name] = true
+		}
+	}
+
+	if prune {
+		for _, name := range networkNames(cur.networks) {
+			if !want[name] {
+				changes = append(changes, Change{Action: changeDelete, Kind: "network", Name: name})
+				gone[name] = true
+			}
+		}
+	}
+
+	for _, e := range endpoints(links) {
+		node, _, _ := splitEndpoint(e)
+
+		c, ok := cur.links[e]
+		if ok && c == links[e] && !gone[node] && !gone[c] {
+			continue
+		}
+
+		changes = append(changes, Change{Action: changeConnect, Kind: "link", Name: e, Detail: "to " + links[e]})
+	}
+
+	if prune {
+		for _, e := range endpoints(cur.links) {
+			node, _, _ := splitEndpoint(e)
+			if _, ok := links[e]; ok || gone[node] || gone[cur.links[e]] {
+				continue
+			}
+
+			changes = append(changes, Change{Action: changeDisconnect, Kind: "link", Name: e, Detail: "from " + cur.links[e]})
+		}
+	}
+
+	return changes
+}
+
+// nodeDiff describes the set fields of n which differ from the lab node c.
+func nodeDiff(n topologyNode, c eveapi.Node) string {
+	var d []string
+
+	for _, f := range []struct {
+		name       string
+		want, have string
+	}{
+		{"image", n.Image, c.Image},
+		{"icon", n.Icon, c.Icon},
+		{"cpu", itoa(n.CPU), itoa(c.CPU)},
+		{"ram", itoa(n.RAM), itoa(c.RAM)},
+		{"ethernet", itoa(n.Ethernet), itoa(c.Ethernet)},
+	} {
+		if f.want != "" && f.want != f.have {
+			d = append(d, fmt.Sprintf("%v %v to %v", f.name, f.have, f.want))
+		}
+	}
+
+	return strings.Join(d, ", ")
+}
+
+// itoa returns the decimal i, or "" for 0.
+func itoa(i int) string {
+	if i == 0 {
+		return ""
+	}
+
+	return strconv.Itoa(i)
+}
+
+// nodeNames returns the names of the nodes, sorted.
+func nodeNames(nodes map[string]eveapi.Node) []string {
+	var names []string
+	for name := range nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// networkNames returns the names of the networks, sorted.
+func networkNames(networks map[string]eveapi.Network) []string {
+	var names []string
+	for name := range networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// endpoints returns the linked endpoints, sorted.
+func endpoints(links map[string]string) []string {
+	var eps []string
+	for e := range links {
+		eps = append(eps, e)
+	}
+	sort.Strings(eps)
+
+	return eps
+}
+
+// applyChanges applies the planned changes to the eve-ng lab.
+func applyChanges(api *eveapi.Client, t *topology, cur *labTopology, changes []Change) error {
+	nodes := map[string]topologyNode{}
+	for _, n := range t.Nodes {
+		nodes[n.Name] = n
+	}
+
+	desiredNetworks, _ := t.desiredLinks()
+	networks := map[string]topologyNetwork{}
+	for _, n := range desiredNetworks {
+		networks[n.Name] = n
+	}
+
+	nodeIDs := map[string]int{}
+	for name, n := range cur.nodes {
+		nodeIDs[name] = n.ID
+	}
+
+	networkIDs := map[string]int{}
+	for name, n := range cur.networks {
+		networkIDs[name] = n.ID
+	}
+
+	for _, ch := range changes {
+		log.Printf("Applying: %v", ch)
+
+		var err error
+		switch ch.Kind + " " + ch.Action {
+		case "lab create":
+			dir, name := splitLabPath(t.Lab)
+			err = api.CreateLab(dir, eveapi.Lab{Name: name, Author: t.Author, Description: t.Description})
+		case "node delete":
+			err = api.DeleteNode(t.Lab, nodeIDs[ch.Name])
+		case "node replace":
+			if err = api.DeleteNode(t.Lab, nodeIDs[ch.Name]); err == nil {
+				nodeIDs[ch.Name], err = api.AddNode(t.Lab, apiNode(nodes[ch.Name]))
+			}
+			delete(cur.ifaces, ch.Name)
+		case "node create":
+			nodeIDs[ch.Name], err = api.AddNode(t.Lab, apiNode(nodes[ch.Name]))
+		case "node update":
+			n := apiNode(nodes[ch.Name])
+			n.ID, n.Left, n.Top = nodeIDs[ch.Name], 0, 0
+			err = api.UpdateNode(t.Lab, n)
+			delete(cur.ifaces, ch.Name)
+		case "network delete":
+			err = api.DeleteNetwork(t.Lab, networkIDs[ch.Name])
+		case "network replace":
+			if err = api.DeleteNetwork(t.Lab, networkIDs[ch.Name]); err == nil {
+				networkIDs[ch.Name], err = api.AddNetwork(t.Lab, apiNetwork(networks[ch.Name]))
+			}
+		case "network create":
+			networkIDs[ch.Name], err = api.AddNetwork(t.Lab, apiNetwork(networks[ch.Name]))
+		case "link connect", "link disconnect":
+			err = applyLink(api, t.Lab, cur, nodeIDs, networkIDs, ch)
+		default:
+			err = fmt.Errorf("unknown change")
+		}
+
+		if err != nil {
+			return fmt.Errorf("could not %v, error: %v", ch, err)
+		}
+	}
+
+	return nil
+}
+
+// applyLink connects or disconnects the interface of the change.
+func applyLink(api *eveapi.Client, lab string, cur *labTopology, nodeIDs, networkIDs map[string]int, ch Change) error {
+	node, name, _ := splitEndpoint(ch.Name)
+	id := nodeIDs[node]
+
+	ifaces, ok := cur.ifaces[node]
+	if !ok {
+		var err error
+		if ifaces, err = api.Interfaces(lab, id); err != nil {
+			return err
+		}
+
+		cur.ifaces[node] = ifaces
+	}
+
+	index := -1
+	for _, i := range ifaces {
+		if i.Name == name || strconv.Itoa(i.Index) == name {
+			index = i.Index
+		}
+	}
+
+	if index < 0 {
+		return fmt.Errorf("node %v has no interface %v", node, name)
+	}
+
+	network := 0
+	if ch.Action == changeConnect {
+		network = networkIDs[strings.TrimPrefix(ch.Detail, "to ")]
+	}
+
+	return api.ConnectInterface(lab, id, index, network)
+}
+
+func apiNode(n topologyNode) eveapi.Node {
+	return eveapi.Node{
+		Name:     n.Name,
+		Template: n.Template,
+		Type:     n.Type,
+		Image:    n.Image,
+		Icon:     n.Icon,
+		CPU:      n.CPU,
+		RAM:      n.RAM,
+		Ethernet: n.Ethernet,
+		Left:     n.Left,
+		Top:      n.Top,
+	}
+}
+
+func apiNetwork(n topologyNetwork) eveapi.Network {
+	nw := eveapi.Network{Name: n.Name, Type: n.Type, Left: n.Left, Top: n.Top, Visibility: 1}
+	if strings.Contains(n.Name, ":") {
+		// Point-to-point link networks, named after their interfaces, are
+		// hidden as eve-ng does.
+		nw.Visibility = 0
+	}
+
+	return nw
+}
+
+// splitLabPath splits the lab path into its folder and lab name, without .unl.
+func splitLabPath(p string) (string, string) {
+	i := strings.LastIndex(p, "/")
+
+	return p[:i+1], strings.TrimSuffix(p[i+1:], ".unl")
+}
+
+// ApplyTopology makes the eve-ng lab described in the topology file match it,
+// deleting the nodes, networks and links it does not describe when prune is
+// set. dryRun only returns the plan. A destructive plan is only applied once
+// confirm, shown the plan first, accepts it.
+func ApplyTopology(instanceName, configFile, file string, prune, dryRun bool, confirm func(*ApplyResult) bool) (*ApplyResult, error) {
+	t, err := loadTopology(file)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := newAPISession(instanceName, configFile)
+	if err != nil {
+		return nil, err
+	}
+	defer a.close()
+
+	cur, exists, err := readLabTopology(a.api, t.Lab)
+	if err != nil {
+		return nil, fmt.Errorf("could not read lab %v, error: %v", t.Lab, err)
+	}
+
+	r := &ApplyResult{Lab: t.Lab, Changes: plan(t, cur, exists, prune)}
+
+	log.Printf("Plan for %v: %d changes", t.Lab, len(r.Changes))
+	for _, ch := range r.Changes {
+		log.Printf("  %v", ch)
+	}
+
+	if dryRun || len(r.Changes) == 0 {
+		return r, nil
+	}
+
+	if r.Destructive() && (confirm == nil || !confirm(r)) {
+		return r, fmt.Errorf("the plan for %v deletes or replaces lab objects and was not confirmed, nothing applied", t.Lab)
+	}
+
+	if err := applyChanges(a.api, t, cur, r.Changes); err != nil {
+		return r, err
+	}
+
+	r.Applied = true
+
+	return r, nil
+}
@@ -0,0 +1,91 @@
+package goeve
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"github.com/amb1s1/go-eve/connect"
+	evecompute "github.com/amb1s1/go-eve/eve-compute"
+)
+
+// Tunnel forwards local ports to the eve-ng web ui and to the node telnet
+// consoles of the compute instance over ssh, until interrupted.
+// The web ui http and https ports are forwarded from httpPort and httpsPort,
+// the console ports, a range like "32769-32868", from the same local ports.
+func Tunnel(instanceName, configFile string, httpPort, httpsPort int, consolePorts string) error {
+	c, err := new(instanceName, configFile, false)
+	if err != nil {
+		return err
+	}
+
+	first, last, err := parsePortRange(consolePorts)
+	if err != nil {
+		return err
+	}
+
+	service, err := evecompute.New()
+	if err != nil {
+		return err
+	}
+
+	sc, err := c.sshClient(service)
+	if err != nil {
+		return err
+	}
+
+	ports := tunnelPorts(httpPort, httpsPort, first, last)
+
+	fmt.Printf("eve-ng web ui: http://localhost:%d\n", httpPort)
+	fmt.Printf("eve-ng web ui: https://localhost:%d\n", httpsPort)
+	fmt.Printf("node consoles: telnet localhost %d-%d\n", first, last)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	return sc.Forward(ctx, ports)
+}
+
+func tunnelPorts(httpPort, httpsPort, first, last int) []connect.Port {
+	ports := []connect.Port{
+		{Local: localAddr(httpPort), Remote: "127.0.0.1:80"},
+		{Local: localAddr(httpsPort), Remote: "127.0.0.1:443"},
+	}
+
+	for p := first; p <= last; p++ {
+		ports = append(ports, connect.Port{Local: localAddr(p), Remote: localAddr(p)})
+	}
+
+	return ports
+}
+
+func localAddr(port int) string {
+	return "127.0.0.1:" + strconv.Itoa(port)
+}
+
+// parsePortRange parses a port range like "32769-32868", or a single port.
+func parsePortRange(r string) (int, int, error) {
+	bounds := strings.SplitN(r, "-", 2)
+	if len(bounds) == 1 {
+		bounds = append(bounds, bounds[0])
+	}
+
+	first, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port range %q, error: %v", r, err)
+	}
+
+	last, err := strconv.Atoi(strings.TrimSpace(bounds[1]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port range %q, error: %v", r, err)
+	}
+
+	if first < 1 || last > 65535 || first > last {
+		return 0, 0, fmt.Errorf("invalid port range %q", r)
+	}
+
+	return first, last, nil
+}
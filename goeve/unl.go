@@ -0,0 +1,190 @@
+package goeve
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/amb1s1/go-eve/connect"
+	evecompute "github.com/amb1s1/go-eve/eve-compute"
+)
+
+// labsDir is where eve-ng keeps the lab files.
+var labsDir = "/opt/unetlab/labs"
+
+// labIDPattern matches the id attribute of the lab element of a .unl file.
+var labIDPattern = regexp.MustCompile(`(<lab\b[^>]*?\bid=")([0-9a-fA-F-]{36})(")`)
+
+// LabTransfer reports an exported or imported eve-ng lab file.
+type LabTransfer struct {
+	Lab   string
+	File  string
+	ID    string
+	NewID bool `json:",omitempty"`
+	Bytes int64
+}
+
+// labID returns the uuid of the .unl lab file content.
+func labID(unl []byte) (string, error) {
+	m := labIDPattern.FindSubmatch(unl)
+	if m == nil {
+		return "", errors.New("no lab id found, is it an eve-ng .unl file?")
+	}
+
+	return string(m[2]), nil
+}
+
+// setLabID replaces the uuid of the .unl lab file content with id.
+func setLabID(unl []byte, id string) []byte {
+	return labIDPattern.ReplaceAll(unl, []byte("${1}"+id+"${3}"))
+}
+
+// newUUID returns a random version 4 uuid.
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// labSSH opens a ssh connection to the lab compute instance.
+func labSSH(instanceName, configFile string) (connect.Functions, error) {
+	c, err := new(instanceName, configFile, false)
+	if err != nil {
+		return nil, err
+	}
+
+	service, err := evecompute.New()
+	if err != nil {
+		return nil, err
+	}
+
+	return c.sshClient(service)
+}
+
+// ExportLab downloads the .unl file of the eve-ng lab at p to the local file,
+// the lab file name in the current directory when file is empty, or in the
+// directory file names.
+func ExportLab(instanceName, configFile, p, file string) (*LabTransfer, error) {
+	p = cleanPath(p)
+	if !isLab(p) {
+		return nil, fmt.Errorf("%v is not an eve-ng lab, its path must end in .unl", p)
+	}
+
+	sc, err := labSSH(instanceName, configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return exportLab(sc, p, file)
+}
+
+func exportLab(sc connect.Functions, p, file string) (*LabTransfer, error) {
+	if file == "" {
+		file = path.Base(p)
+	}
+
+	// The file Pull writes, so the lab is read back from it.
+	file = connect.LocalDest(file, p)
+
+	r, err := sc.Pull(labsDir+p, file, true)
+	if err != nil {
+		return nil, err
+	}
+
+	unl, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := labID(unl)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LabTransfer{Lab: p, File: file, ID: id, Bytes: r.Bytes}, nil
+}
+
+// ImportLab uploads the local .unl file into the eve-ng folder. The lab gets a
+// new uuid when newID is set, or when another lab on the instance has the
+// same one. An existing lab of the same name is only replaced with force.
+func ImportLab(instanceName, configFile, file, folder string, newID, force bool) (*LabTransfer, error) {
+	unl, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read lab file %v, error: %v", file, err)
+	}
+
+	id, err := labID(unl)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", file, err)
+	}
+
+	p := path.Join(cleanPath(folder), filepath.Base(file))
+	if !isLab(p) {
+		return nil, fmt.Errorf("%v is not an eve-ng lab file, its name must end in .unl", file)
+	}
+
+	sc, err := labSSH(instanceName, configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	dst := labsDir + p
+
+	if _, err := sc.Run("sudo test -e " + connect.ShellQuote(dst)); err == nil && !force {
+		return nil, fmt.Errorf("lab %v already exists, import with force to replace it", p)
+	}
+
+	if !newID {
+		// Other labs with the same id would share their running nodes.
+		out, _ := sc.Run(fmt.Sprintf("sudo grep -rlF --include=*.unl %v %v | grep -vxF %v || true", connect.ShellQuote(`id="`+id+`"`), labsDir, connect.ShellQuote(dst)))
+		newID = strings.TrimSpace(string(out)) != ""
+	}
+
+	r := &LabTransfer{Lab: p, File: file, ID: id, NewID: newID}
+
+	if newID {
+		if r.ID, err = newUUID(); err != nil {
+			return nil, err
+		}
+
+		tmp, err := ioutil.TempFile("", "go-eve-*.unl")
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(tmp.Name())
+
+		_, err = tmp.Write(setLabID(unl, r.ID))
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		file = tmp.Name()
+	}
+
+	res, err := sc.Push(file, dst, true)
+	if err != nil {
+		return nil, err
+	}
+	r.Bytes = res.Bytes
+
+	if out, err := sc.Run(fmt.Sprintf("sudo chown www-data:www-data %v && sudo /opt/unetlab/wrappers/unl_wrapper -a fixpermissions", connect.ShellQuote(dst))); err != nil {
+		return nil, fmt.Errorf("could not fix the lab permissions, error: %v, output: %s", err, out)
+	}
+
+	return r, nil
+}
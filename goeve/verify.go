@@ -0,0 +1,138 @@
+package goeve
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/amb1s1/go-eve/connect"
+	evecompute "github.com/amb1s1/go-eve/eve-compute"
+)
+
+var (
+	// verifyServices are the systemd services eve-ng needs.
+	verifyServices = []string{"apache2", "mysql", "unetlab"}
+	// verifyURLs are the eve-ng web ui urls, as seen from the compute instance.
+	verifyURLs = []string{"http://127.0.0.1/", "https://127.0.0.1/"}
+	// httpTimeout limits the http requests to the compute instance.
+	httpTimeout = 30 * time.Second
+)
+
+// Check is the result of a post-install verification check.
+type Check struct {
+	Name   string
+	Passed bool
+	Detail string `json:",omitempty"`
+}
+
+// httpClient returns a http client reaching the compute instance through the
+// ssh connection, so no firewall rule is needed. Eve-ng uses a self-signed
+// certificate, which is not verified.
+func httpClient(sc connect.Functions) *http.Client {
+	return &http.Client{
+		Timeout: httpTimeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return sc.Dial(network, addr)
+			},
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+}
+
+// verify checks eve-ng is up and running on the compute instance.
+func verify(sc connect.Functions) []Check {
+	var checks []Check
+
+	hc := httpClient(sc)
+	for _, u := range verifyURLs {
+		ch := Check{Name: "web ui " + u}
+
+		resp, err := hc.Get(u)
+		if err != nil {
+			ch.Detail = err.Error()
+		} else {
+			resp.Body.Close()
+			ch.Passed = resp.StatusCode < 400
+			ch.Detail = resp.Status
+		}
+
+		checks = append(checks, ch)
+	}
+
+	for _, s := range verifyServices {
+		out, err := sc.Run("systemctl is-active " + s)
+		checks = append(checks, Check{
+			Name:   "service " + s,
+			Passed: err == nil,
+			Detail: strings.TrimSpace(string(out)),
+		})
+	}
+
+	_, err := sc.Run("test -c /dev/kvm")
+	ch := Check{Name: "/dev/kvm", Passed: err == nil}
+	if err != nil {
+		ch.Detail = "missing, nested virtualization is not enabled"
+	}
+	checks = append(checks, ch)
+
+	out, err := sc.Run("sudo kvm-ok")
+	checks = append(checks, Check{
+		Name:   "kvm-ok",
+		Passed: err == nil,
+		Detail: strings.TrimSpace(string(out)),
+	})
+
+	for _, ch := range checks {
+		log.Printf("Verification check %v passed: %v %v", ch.Name, ch.Passed, ch.Detail)
+	}
+
+	return checks
+}
+
+// passed returns whether all the checks passed.
+func passed(checks []Check) bool {
+	for _, ch := range checks {
+		if !ch.Passed {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Verify checks eve-ng is up and running on the compute instance.
+func Verify(instanceName, configFile string) (*Status, error) {
+	c, err := new(instanceName, configFile, false)
+	if err != nil {
+		return nil, err
+	}
+
+	service, err := evecompute.New()
+	if err != nil {
+		return nil, err
+	}
+
+	sc, err := c.sshClient(service)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Status = &Status{
+		Instance: "running",
+		Settings: "not modified",
+		Checks:   verify(sc),
+	}
+	c.Status.Edition, c.Status.License = c.editionStatus(sc)
+
+	if !passed(c.Status.Checks) {
+		return c.Status, fmt.Errorf("eve-ng verification failed on %v", c.InstanceName)
+	}
+
+	return c.Status, nil
+}
@@ -0,0 +1,55 @@
+package goeve
+
+import (
+	"fmt"
+
+	"github.com/amb1s1/go-eve/connect"
+	evecompute "github.com/amb1s1/go-eve/eve-compute"
+)
+
+// versions reports the versions installed on the compute instance in the
+// status, and whether they match the pinned eve-ng version.
+func (c *client) versions(sc connect.Functions) error {
+	v, err := connect.GetVersions(sc)
+	if err != nil {
+		return err
+	}
+
+	c.Status.Versions = v
+
+	want := c.EveSetup.Package() + " " + c.EveSetup.EveVersion
+	if c.EveSetup.EveVersion != "" && v.EveNG != want {
+		c.Status.Settings += fmt.Sprintf(", %v installed instead of the pinned %v", v.EveNG, want)
+	}
+
+	return nil
+}
+
+// RemoteVersions collects the eve-ng and host software versions of the compute instance.
+func RemoteVersions(instanceName, configFile string) (*Status, error) {
+	c, err := new(instanceName, configFile, false)
+	if err != nil {
+		return nil, err
+	}
+
+	service, err := evecompute.New()
+	if err != nil {
+		return nil, err
+	}
+
+	sc, err := c.sshClient(service)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Status = &Status{
+		Instance: "running",
+		Settings: "not modified",
+	}
+
+	if err := c.versions(sc); err != nil {
+		return nil, err
+	}
+
+	return c.Status, nil
+}
@@ -8,10 +8,14 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"log"
 
 	"github.com/amb1s1/go-eve/goeve"
 )
 
+// version is the go-eve version, set at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
 var (
 	instanceName      = flag.String("instance_name", "", "name of your compute instance")
 	configFile        = flag.String("config_file", "config.yaml", "absolute path to the goeve config file")
@@ -24,6 +28,15 @@ var (
 
 func main() {
 	flag.Parse()
+
+	if flag.NArg() > 0 {
+		if err := runCommand(flag.Arg(0), flag.Args()[1:]); err != nil {
+			log.Fatalf("Could not run command %v, error: %v", flag.Arg(0), err)
+		}
+
+		return
+	}
+
 	out := goeve.Run(*instanceName, *configFile, *createCustomImage, *create, *resetInstance, *stop, *teardown)
 	s, _ := json.MarshalIndent(out, "", "\t")
 	fmt.Print(string(s))
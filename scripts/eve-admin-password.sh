@@ -0,0 +1,32 @@
+#!/bin/bash
+# Sets the password of the eve-ng web admin user through the eve-ng api.
+api=http://127.0.0.1/api
+new_password={{.Secret "admin_password"}}
+
+if [[ -z "${new_password}" ]]; then
+    echo "No admin password configured, keeping the eve-ng default"
+    exit
+fi
+
+jar=$(mktemp)
+trap 'rm -f "${jar}"' EXIT
+
+login() {
+    curl -s -c "${jar}" -b "${jar}" -H 'Content-Type: application/json' \
+        -d "{\"username\":\"admin\",\"password\":\"$1\",\"html5\":\"-1\"}" \
+        "${api}/auth/login" | grep -q '"status":"success"'
+}
+
+if login "${new_password}"; then
+    echo "Admin password already set"
+    exit
+fi
+
+if ! login 'eve'; then
+    echo "Could not log in to the eve-ng api as admin"
+    exit 1
+fi
+
+curl -s -c "${jar}" -b "${jar}" -X PUT -H 'Content-Type: application/json' \
+    -d "{\"name\":\"Administrator\",\"email\":\"root@localhost\",\"password\":\"${new_password}\",\"role\":\"admin\",\"expiration\":\"-1\",\"pod\":0,\"pexpiration\":\"-1\"}" \
+    "${api}/users/admin" | grep -q '"status":"success"'
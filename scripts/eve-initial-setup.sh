@@ -1,10 +1,5 @@
 #!/bin/bash
 
-# Check if VM is already configured
-if [[ -e /opt/ovf/.configured ]]; then
-    exit
-fi
-
 . ~/.profile
 
 echo "Eve-NG - Setup"
@@ -16,7 +11,7 @@ if [[ ! -e "/sys/class/net/eth0" ]]; then
 fi
 
 # Setting root password
-ovf_root_password='eve-pwd'
+ovf_root_password={{.Secret "root_password"}}
 echo root:"${ovf_root_password}" | chpasswd 2>&1 > /dev/null
 
 # Checking if ovf parameters exist
@@ -27,12 +22,20 @@ if [ $? -eq 0 ]; then
         xsltproc /opt/ovf/ovf.xsl /opt/ovf/ovf.xml | sed 's/vami\.//' | sed 's/\.unetlab//' > /opt/ovf/ovf_vars
         . /opt/ovf/ovf_vars
 else
-        # Using interactive input
-        ovf_hostname="eve-ng"
-        ovf_domain="example"
-        ovf_dhcp="dhcp" 
-        ovf_ntp=""
-        ovf_proxy_type="direct connection"
+        # Using the go-eve config
+        ovf_hostname={{quote .Hostname}}
+        ovf_domain={{quote .Domain}}
+        ovf_dhcp={{quote .Network}}
+        ovf_ip={{quote .IP}}
+        ovf_netmask={{quote .Netmask}}
+        ovf_gateway={{quote .Gateway}}
+        ovf_dns1={{quote (index .DNS 0)}}
+        ovf_dns2={{quote (join (slice .DNS 1) " ")}}
+        ovf_ntp={{quote (join .NTP " ")}}
+        ovf_proxy_type={{quote .Proxy.ScriptType}}
+        ovf_proxy_url={{quote .Proxy.URL}}
+        ovf_proxy_username={{quote .Proxy.Username}}
+        ovf_proxy_password={{.Secret "proxy_password"}}
 
 fi
 
@@ -72,65 +75,23 @@ fi
 cat >> /etc/network/interfaces << EOF
 
 # Cloud devices
-iface eth1 inet manual
-auto pnet1
-iface pnet1 inet manual
-    bridge_ports eth1
-    bridge_stp off
-
-iface eth2 inet manual
-auto pnet2
-iface pnet2 inet manual
-    bridge_ports eth2
-    bridge_stp off
-
-iface eth3 inet manual
-auto pnet3
-iface pnet3 inet manual
-    bridge_ports eth3
-    bridge_stp off
-
-iface eth4 inet manual
-auto pnet4
-iface pnet4 inet manual
-    bridge_ports eth4
-    bridge_stp off
-
-iface eth5 inet manual
-auto pnet5
-iface pnet5 inet manual
-    bridge_ports eth5
-    bridge_stp off
-
-iface eth6 inet manual
-auto pnet6
-iface pnet6 inet manual
-    bridge_ports eth6
-    bridge_stp off
-
-iface eth7 inet manual
-auto pnet7
-iface pnet7 inet manual
-    bridge_ports eth7
-    bridge_stp off
-
-iface eth8 inet manual
-auto pnet8
-iface pnet8 inet manual
-    bridge_ports eth8
-    bridge_stp off
-
-iface eth9 inet manual
-auto pnet9
-iface pnet9 inet manual
-    bridge_ports eth9
+{{- range $i, $b := .CloudBridges}}
+{{- if $i}}
+{{end}}
+{{- if ne $b.Port "none"}}
+iface {{$b.Port}} inet manual
+{{- end}}
+auto pnet{{$b.Pnet}}
+iface pnet{{$b.Pnet}} inet manual
+    bridge_ports {{$b.Port}}
     bridge_stp off
+{{- end}}
 EOF
 
 # Setting the NTP server
 if [ "${ovf_ntp}" != '' ]; then
     sed -i 's/NTPDATE_USE_NTP_CONF=.*/NTPDATE_USE_NTP_CONF=no/g' /etc/default/ntpdate
-    sed -i 's/NTPSERVERS=.*/NTPSERVERS=${ovf_ntp}/g' /etc/default/ntpdate
+    sed -i "s/NTPSERVERS=.*/NTPSERVERS=\"${ovf_ntp}\"/g" /etc/default/ntpdate
 else
     sed -i 's/NTPDATE_USE_NTP_CONF=.*/NTPDATE_USE_NTP_CONF=yes/g' /etc/default/ntpdate
     sed -i 's/NTPSERVERS=.*/NTPSERVERS=/g' /etc/default/ntpdate
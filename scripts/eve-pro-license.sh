@@ -0,0 +1,8 @@
+#!/bin/bash
+# Installs the eve-ng professional license.
+license_path={{quote .LicensePath}}
+
+mkdir -p "$(dirname "${license_path}")"
+echo {{.Secret "license"}} | base64 -d > "${license_path}"
+chown www-data:www-data "${license_path}"
+chmod 640 "${license_path}"
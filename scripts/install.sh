@@ -1,15 +1,19 @@
 #!/bin/bash
-# Check if VM is already configured
-if [[ -e /opt/ovf/.configured ]]; then
-    echo "VM is already configured"
-    exit
-fi
 # Avoiding grub config gui prompt
 sed -i "s/#\ conf_force_conffold=YES/conf_force_conffold=YES/g" /etc/ucf.conf
 
 
+{{- if eq .Edition "pro"}}
+wget -O - https://www.eve-ng.net/repo/install-eve-pro.sh | bash -i
+{{- else}}
 wget -O - http://www.eve-ng.net/repo/install-eve.sh | bash -i
+{{- end}}
 sudo apt-get update
+{{- if .EveVersion}}
+# Pinning the eve-ng version, so rebuilds install the same one
+sudo apt-get install -y --allow-downgrades {{.Package}}={{quote .EveVersion}}
+sudo apt-mark hold {{.Package}}
+{{- end}}
 sudo apt-get -y upgrade
 sudo apt-get install dialog
 # Avoiding OS to rename eth0 interface to ens4
@@ -0,0 +1,77 @@
+// Package scripts embeds the provisioning scripts run on the eve-ng compute instance.
+//
+// The scripts are compiled into the go-eve binary, so go-eve can run from any
+// directory. Any script can be overridden by a local file. The embedded scripts
+// are text/template templates, rendered with the go-eve config before upload;
+// local files are only rendered when asked to.
+package scripts
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+	"text/template"
+)
+
+// funcs are the functions available to the script templates.
+var funcs = template.FuncMap{
+	// quote quotes a value for the shell.
+	"quote": func(s string) string {
+		return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+	},
+	"join": strings.Join,
+}
+
+//go:embed *.sh
+var files embed.FS
+
+// Read returns the content of the script name.
+// If override is not empty, the script is read from the local file override instead.
+func Read(name, override string) ([]byte, error) {
+	if override != "" {
+		log.Printf("Reading script %v from local file %v", name, override)
+
+		f, err := ioutil.ReadFile(override)
+		if err != nil {
+			return nil, fmt.Errorf("could not read script override %v for %v, error: %v", override, name, err)
+		}
+
+		return f, nil
+	}
+
+	f, err := files.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown script %v, error: %v", name, err)
+	}
+
+	return f, nil
+}
+
+// Render returns the script name, read like Read does, rendered with data.
+// A local override is only rendered with templateOverride, so plain scripts
+// can use {{ in awk or jq programs.
+func Render(name, override string, templateOverride bool, data interface{}) ([]byte, error) {
+	f, err := Read(name, override)
+	if err != nil {
+		return nil, err
+	}
+
+	if override != "" && !templateOverride {
+		return f, nil
+	}
+
+	t, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(string(f))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse script %v, error: %v", name, err)
+	}
+
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return nil, fmt.Errorf("could not render script %v, error: %v", name, err)
+	}
+
+	return b.Bytes(), nil
+}